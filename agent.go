@@ -3,10 +3,12 @@ package go_as
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	mcpcore "github.com/mark3labs/mcp-go/mcp"
@@ -14,7 +16,7 @@ import (
 
 // Agent struct represents a new kind of agent that is decoupled from the LLM during task execution.
 type Agent struct {
-	llmClient      *LLMClient
+	llmClient      LLMProvider
 	mcpClients     map[string]*MCPClient
 	logger         *slog.Logger
 	history        []Message    // Full conversation history for the LLM
@@ -25,10 +27,31 @@ type Agent struct {
 	currentPlan    []string // Stores the high-level plan generated by the Orchestrator persona
 	currentStepIdx int      // Tracks which step of the plan Nexus is currently on
 	originalQuery  string   // Store the initial user query for consistent context
+
+	updateChan      chan<- OrchestrationUpdate // Optional; receives progress updates during Execute
+	lastStepStarted int                        // Last plan step reported with a step_started update
+	toolCallSeq     int                        // Counter for IDs given to tool calls the model sent without one
+
+	budget        AgentBudget    // Limits enforced during Execute
+	steps         int            // Execution phase LLM turns taken in this run
+	toolCalls     int            // Tool calls made in this run
+	seenToolCalls map[string]int // Times each tool call (name and arguments) was requested, for loop detection
+
+	strategy     AgentStrategy       // How Execute works through a task
+	approvals    *ApprovalManager    // Optional; pauses tool calls that need a human decision
+	record       *RunRecord          // Plan versions of the current run
+	stepFailures int                 // Consecutive tool call batches that failed on the current step
+	replans      int                 // Times the plan was revised in this run
+	dryRun       bool                // Record and validate tool calls instead of running them
+	model        string              // Model that produced the latest LLM response; an LLMFallback can change it mid-run
+	jsonRepairs  *JSONRepairRecorder // Optional; counts the malformed JSON repaired in LLM responses
 }
 
+// maxStepFailures is how many times the tool calls of a plan step may fail before the agent replans.
+const maxStepFailures = 2
+
 // NewAgent creates a new instance of the Agent.
-func NewAgent(llmClient *LLMClient, mcpClients map[string]*MCPClient, logger *slog.Logger, availableTools []Tool) *Agent {
+func NewAgent(llmClient LLMProvider, mcpClients map[string]*MCPClient, logger *slog.Logger, availableTools []Tool) *Agent {
 	return &Agent{
 		llmClient:      llmClient,
 		mcpClients:     mcpClients,
@@ -39,22 +62,351 @@ func NewAgent(llmClient *LLMClient, mcpClients map[string]*MCPClient, logger *sl
 		currentPlan:    nil,
 		currentStepIdx: 0,
 		originalQuery:  "",
+		budget:         DefaultAgentBudget(),
+		strategy:       PlanExecuteStrategy{},
+	}
+}
+
+// SetApprovals makes tool calls selected by approvals' policy wait for a decision before they run.
+func (a *Agent) SetApprovals(approvals *ApprovalManager) {
+	a.approvals = approvals
+}
+
+// SetJSONRepairRecorder makes the agent count the malformed JSON it repairs in recorder.
+func (a *Agent) SetJSONRepairRecorder(recorder *JSONRepairRecorder) {
+	a.jsonRepairs = recorder
+}
+
+// SetStrategy replaces the strategy Execute uses, which defaults to PlanExecuteStrategy.
+func (a *Agent) SetStrategy(strategy AgentStrategy) {
+	a.strategy = strategy
+}
+
+// Record returns the record of the current or last run, including every version of its plan.
+func (a *Agent) Record() RunRecord {
+	if a.record == nil {
+		return RunRecord{}
+	}
+	record := *a.record
+	record.Plans = append([]PlanVersion(nil), a.record.Plans...)
+	if a.record.DryRun != nil {
+		dryRun := *a.record.DryRun
+		dryRun.ToolCalls = append([]PlannedToolCall(nil), dryRun.ToolCalls...)
+		record.DryRun = &dryRun
+	}
+	return record
+}
+
+// SetBudget replaces the limits enforced by Execute, which default to DefaultAgentBudget.
+func (a *Agent) SetBudget(budget AgentBudget) {
+	a.budget = budget
+}
+
+// SetUpdateChannel makes Execute report its progress (plan, steps, tool calls and results,
+// and streamed LLM tokens) on updateChan. The channel is not closed by the agent.
+func (a *Agent) SetUpdateChannel(updateChan chan<- OrchestrationUpdate) {
+	a.updateChan = updateChan
+}
+
+// emit sends a progress update if an update channel is set. Updates reporting what the model
+// decided are tagged with the model that produced the latest LLM response.
+func (a *Agent) emit(ctx context.Context, update OrchestrationUpdate) {
+	if a.updateChan == nil {
+		return
+	}
+	switch update.Type {
+	case UpdateTypePlan, UpdateTypeToolCall, UpdateTypeApprovalRequired, UpdateTypeToolResult:
+		update.Model = a.model
+	}
+	sendUpdate(ctx, a.updateChan, update)
+}
+
+// startStep emits a step_started update the first time the current plan step is worked on.
+func (a *Agent) startStep(ctx context.Context) {
+	step := a.currentStepIdx + 1
+	if step == a.lastStepStarted {
+		return
+	}
+	a.lastStepStarted = step
+	content := ""
+	if a.currentStepIdx < len(a.currentPlan) {
+		content = a.currentPlan[a.currentStepIdx]
+	}
+	a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeStepStarted, Step: step, Content: content})
+}
+
+// callLLM sends messages to the LLM. When progress updates are enabled the response
+// is streamed so that content fragments can be forwarded as token updates.
+func (a *Agent) callLLM(ctx context.Context, messages []Message) (*ChatCompletionResponse, error) {
+	var response *ChatCompletionResponse
+	var err error
+	if a.updateChan == nil {
+		response, err = a.llmClient.CallChatCompletion(ctx, messages, a.availableTools)
+	} else {
+		response, err = a.llmClient.StreamChatCompletionWithToolChoice(ctx, messages, a.availableTools, nil, func(delta string) {
+			a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeToken, Content: delta})
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.model = response.Model
+	a.record.Model = response.Model
+	return response, nil
+}
+
+// toolCallOutcome is the result of one tool call as reported to the LLM.
+type toolCallOutcome struct {
+	content string
+	failure error // Set if the tool call failed; content then describes the failure
+}
+
+// runToolCalls executes every tool call from one assistant message and appends one "tool"
+// message per call, in the order the calls were made, tagged with the call's ID.
+// Calls to different MCP agents run concurrently; calls to the same agent run in order,
+// since they may depend on each other's side effects. The first tool failure, if any,
+// is returned as failure; err is only set if the run cannot continue.
+func (a *Agent) runToolCalls(ctx context.Context, toolCalls []ToolCall) (failure error, err error) {
+	if err := a.checkToolCallBudget(toolCalls); err != nil {
+		return nil, err
+	}
+	if a.dryRun {
+		a.skipToolCalls(ctx, toolCalls)
+		return nil, nil
+	}
+
+	outcomes := make([]toolCallOutcome, len(toolCalls))
+	errs := make([]error, len(toolCalls))
+
+	var aliases []string
+	byAlias := make(map[string][]int)
+	for i, toolCall := range toolCalls {
+		alias, _, _ := strings.Cut(toolCall.Function.Name, ".")
+		if _, ok := byAlias[alias]; !ok {
+			aliases = append(aliases, alias)
+		}
+		byAlias[alias] = append(byAlias[alias], i)
+	}
+
+	var wg sync.WaitGroup
+	for _, alias := range aliases {
+		wg.Add(1)
+		go func(indices []int) {
+			defer wg.Done()
+			for _, i := range indices {
+				outcomes[i], errs[i] = a.runToolCall(ctx, a.currentStepIdx+1, &toolCalls[i], nil)
+			}
+		}(byAlias[alias])
+	}
+	wg.Wait()
+
+	for i, toolCall := range toolCalls {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if failure == nil {
+			failure = outcomes[i].failure
+		}
+		a.history = append(a.history, Message{Role: "tool", Content: outcomes[i].content, ToolCallID: toolCall.ID, Name: toolCall.Function.Name, toolFailed: outcomes[i].failure != nil})
+	}
+	return failure, nil
+}
+
+// normalizeToolCalls returns toolCalls with every call given an ID and type, so that the
+// "tool" messages answering them can reference the call. Models without function calling,
+// and some that have it, omit both. Malformed JSON arguments are repaired where possible.
+func (a *Agent) normalizeToolCalls(toolCalls []ToolCall) []ToolCall {
+	if len(toolCalls) == 0 {
+		return nil
+	}
+	normalized := make([]ToolCall, len(toolCalls))
+	for i, toolCall := range toolCalls {
+		if toolCall.ID == "" {
+			a.toolCallSeq++
+			toolCall.ID = fmt.Sprintf("call_%d", a.toolCallSeq)
+		}
+		if toolCall.Type == "" {
+			toolCall.Type = "function"
+		}
+		if strings.TrimSpace(toolCall.Function.Arguments) != "" {
+			if arguments, fixes, ok := a.jsonRepairs.repair(JSONSourceToolArguments, toolCall.Function.Arguments); ok && len(fixes) > 0 {
+				a.logger.Info("Agent: Repaired malformed tool arguments.", "tool", toolCall.Function.Name, "fixes", fixes)
+				toolCall.Function.Arguments = arguments
+			}
+		}
+		normalized[i] = toolCall
+	}
+	return normalized
+}
+
+// runToolCall executes a tool call for plan step step (1-based), reports it and returns the
+// outcome for its "tool" message. Tool failures are returned in the outcome for the LLM to
+// handle; only an error synthesizing a successful result is returned as an error. If lock is
+// not nil, it is held while the tool runs, but not while the call waits for approval.
+func (a *Agent) runToolCall(ctx context.Context, step int, toolCall *ToolCall, lock sync.Locker) (toolCallOutcome, error) {
+	a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeToolCall, Step: step, Tool: toolCall.Function.Name, Arguments: toolCall.Function.Arguments})
+
+	var toolResult *mcpcore.CallToolResult
+	execErr := a.checkToolArguments(toolCall) // Invalid arguments neither need a decision nor a remote call
+	if execErr == nil && a.approvals != nil && a.approvals.Requires(toolCall.Function.Name) {
+		execErr = a.awaitApproval(ctx, step, toolCall)
+	}
+	if execErr == nil {
+		if lock != nil {
+			lock.Lock()
+		}
+		toolResult, execErr = a.executeToolCall(ctx, toolCall)
+		if lock != nil {
+			lock.Unlock()
+		}
+	}
+	if execErr != nil {
+		content := fmt.Sprintf("Tool execution failed: %v", execErr)
+		var argsErr *ToolArgumentsError
+		if errors.As(execErr, &argsErr) {
+			content = argsErr.toolResult()
+		}
+		a.logger.Error("Agent: Tool execution failed.", "tool", toolCall.Function.Name, "error", execErr)
+		a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeToolResult, Step: step, Tool: toolCall.Function.Name, Content: content, Error: execErr})
+		return toolCallOutcome{content: content, failure: execErr}, nil
+	}
+
+	synthesizedResult, err := a.synthesizer.Synthesize(toolResult) // Use the agent's synthesizer
+	if err != nil {
+		return toolCallOutcome{}, fmt.Errorf("failed to synthesize tool result: %w", err)
+	}
+	a.logger.Info("Agent: Tool execution successful.", "tool", toolCall.Function.Name, "result", synthesizedResult)
+	a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeToolResult, Step: step, Tool: toolCall.Function.Name, Content: synthesizedResult})
+	return toolCallOutcome{content: synthesizedResult}, nil
+}
+
+// setPlan makes steps, parsed from planContent, the current plan, records it as a new
+// version and reports it. Work restarts at the first step of the new plan.
+func (a *Agent) setPlan(ctx context.Context, planContent string, steps []string, reason string) {
+	a.currentPlan = steps
+	a.currentStepIdx = 0
+	a.lastStepStarted = 0
+	a.stepFailures = 0
+	version := a.record.addPlan(a.currentPlan, reason, a.model)
+	a.logger.Info("Agent: Generated plan.", "plan", strings.Join(a.currentPlan, "; "), "version", version)
+	a.emit(ctx, OrchestrationUpdate{Type: UpdateTypePlan, Content: planContent, Plan: a.currentPlan, PlanVersion: version})
+}
+
+// finishStep moves on to the next plan step once its tool calls succeed. A step whose tool
+// calls keep failing is left for Nexus to retry until maxStepFailures, after which the
+// plan is revised; the tool calls for the first step of the revised plan are returned.
+func (a *Agent) finishStep(ctx context.Context, failure error) ([]ToolCall, error) {
+	if failure == nil {
+		a.stepFailures = 0
+		a.currentStepIdx++
+		return nil, nil
+	}
+	a.stepFailures++
+	if a.stepFailures < maxStepFailures {
+		return nil, nil
+	}
+	return a.replan(ctx, fmt.Sprintf("step %d failed %d times, last error: %v", a.currentStepIdx+1, a.stepFailures, failure))
+}
+
+// replan asks the Orchestrator persona for a revised plan given the history so far and
+// returns the tool calls it recommends for the revised plan's first step.
+func (a *Agent) replan(ctx context.Context, reason string) ([]ToolCall, error) {
+	if a.budget.MaxReplans > 0 && a.replans >= a.budget.MaxReplans {
+		return nil, a.budgetExceeded(BudgetMaxReplans, fmt.Sprintf("plan revised %d times, needs revising again: %s", a.replans, reason))
+	}
+	a.replans++
+	a.logger.Info("Agent: Replanning.", "reason", reason, "replans", a.replans)
+
+	replanningMessages := []Message{{Role: "system", Content: getOrchestratorSystemPrompt(a.availableTools)}}
+	for _, message := range a.history {
+		if message.Role != "system" { // The planning system prompt is replaced by the one above
+			replanningMessages = append(replanningMessages, message)
+		}
+	}
+	replanningMessages = append(replanningMessages, Message{Role: "user", Content: getReplanningPrompt(reason, a.currentPlan, a.currentStepIdx)})
+
+	llmResponse, err := a.callLLM(ctx, replanningMessages)
+	if err != nil {
+		return nil, fmt.Errorf("orchestrator replanning failed: %w", err)
+	}
+	message := llmResponse.Choices[0].Message
+	planContent, foundPlan := extractContentBetweenTags(message.Content, "<plan>", "</plan>")
+	if !foundPlan {
+		return nil, fmt.Errorf("orchestrator did not provide a parsable revised plan. Last LLM content: '%s'", message.Content)
+	}
+	structuredPlan, err := parseStructuredPlan(planContent)
+	if err != nil {
+		return nil, fmt.Errorf("orchestrator provided an invalid revised plan: %w", err)
+	}
+	if structuredPlan != nil {
+		// The structured plan's steps carry their own tool calls, which run right away.
+		message.ToolCalls = nil
+		a.history = append(a.history, message)
+		a.setPlan(ctx, planContent, structuredPlan.descriptions(), reason)
+		return nil, a.runStructuredPlan(ctx, structuredPlan)
+	}
+
+	toolCalls, err := a.planningToolCalls(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal revised plan tool calls JSON: %w", err)
 	}
+	message.ToolCalls = a.normalizeToolCalls(toolCalls)
+	a.history = append(a.history, message)
+	a.setPlan(ctx, planContent, parseNumberedList(planContent), reason)
+	return message.ToolCalls, nil
 }
 
-// Execute is responsible for executing the agent's tasks.
+// Execute is responsible for executing the agent's tasks, using the agent's strategy. If the
+// run is stopped by its budget, Execute returns a partial answer together with a *BudgetExceededError.
 func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
+	a.steps, a.toolCalls, a.seenToolCalls = 0, 0, nil
+	a.stepFailures, a.replans = 0, 0
+	a.currentPlan, a.currentStepIdx, a.lastStepStarted = nil, 0, 0
+	a.model = ""
+	a.record = &RunRecord{Query: query, Strategy: a.strategy.Name()}
+	if a.dryRun {
+		a.record.DryRun = &DryRunReport{}
+	}
 	a.originalQuery = query
+	a.history = nil
+
+	runCtx := ctx
+	if a.budget.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, a.budget.MaxDuration)
+		defer cancel()
+	}
+
+	result, err := a.strategy.Run(runCtx, a, query)
+	if a.dryRun && (err == nil || errors.Is(err, errDryRunStopped)) {
+		return a.finishDryRun(), nil
+	}
+	var budgetErr *BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		return budgetErr.PartialAnswer, err
+	}
+	// Only our own deadline counts against the budget; a cancelled or expired caller context is returned as is.
+	if err != nil && ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		budgetErr = a.budgetExceeded(BudgetMaxDuration, fmt.Sprintf("run took longer than %s", a.budget.MaxDuration))
+		return budgetErr.PartialAnswer, budgetErr
+	}
+	return result, err
+}
+
+// planAndExecute runs PlanExecuteStrategy: the Orchestrator persona plans the task and
+// Nexus executes the plan step by step.
+func (a *Agent) planAndExecute(ctx context.Context, query string) (string, error) {
 	// Initialize history with only the original user query.
 	// The system prompt for planning will be added dynamically per retry.
 	a.history = []Message{{Role: "user", Content: query}}
 
 	// Declare variables outside the loop to ensure they are in scope for Phase 2
 	var llmResponse *ChatCompletionResponse
-	var message Message // Will hold llmResponse.Choices[0].Message
-	var firstToolCall *ToolCall
-	var planFound bool        // To track if a parsable plan was successfully obtained
-	var lastLLMContent string // Store content of the last LLM response for error reporting
+	var message Message                // Will hold llmResponse.Choices[0].Message
+	var plannedToolCalls []ToolCall    // Tool calls recommended by the planning phase, run before asking Nexus
+	var structuredPlan *StructuredPlan // Set if the plan was given as JSON; its steps run without Nexus
+	var planFound bool                 // To track if a parsable plan was successfully obtained
+	var lastLLMContent string          // Store content of the last LLM response for error reporting
 
 	// --- Phase 1: Orchestrator (Planning) ---
 	const maxPlanningRetries = 3 // Define how many times to retry planning
@@ -74,14 +426,14 @@ func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
 		a.logger.Info("Agent: Sending planning messages to LLM.", "messages", string(planningMessagesJSON), "retry", retryCount)
 
 		var currentLLMResponse *ChatCompletionResponse // Use a temporary var for this iteration's response
-		currentLLMResponse, err := a.llmClient.CallChatCompletion(ctx, planningMessages, a.availableTools)
+		currentLLMResponse, err := a.callLLM(ctx, planningMessages)
 		if err != nil {
 			a.logger.Error("Orchestrator planning LLM call failed.", "error", err, "retry", retryCount)
-			if retryCount == maxPlanningRetries-1 {
-				return "", fmt.Errorf("orchestrator planning failed after %d retries: %w", maxPlanningRetries, err)
+			if ctx.Err() != nil {
+				return "", fmt.Errorf("orchestrator planning cancelled: %w", ctx.Err())
 			}
-			time.Sleep(1 * time.Second) // Small delay before retrying
-			continue                    // Retry
+			// Transient failures have already been retried by the LLM client; only unusable plans are retried here.
+			return "", fmt.Errorf("orchestrator planning failed: %w", err)
 		}
 
 		// Assign to the outer-scoped llmResponse and message
@@ -97,12 +449,50 @@ func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
 			if retryCount == maxPlanningRetries-1 {
 				return "", fmt.Errorf("orchestrator did not provide a parsable plan after %d retries. Last LLM content: '%s'", maxPlanningRetries, lastLLMContent)
 			}
-			time.Sleep(1 * time.Second) // Small delay before retrying
-			continue                    // Retry
+			if err := sleepContext(ctx, 1*time.Second); err != nil { // Small delay before retrying
+				return "", fmt.Errorf("orchestrator planning cancelled: %w", err)
+			}
+			continue // Retry
 		}
 
-		// 2. Extract Tool Calls JSON from the *entire* message content
-		toolCallsJSONStr, foundToolCalls := extractToolCallsJSON(message.Content)
+		// 2. A plan given as JSON is a DAG of steps with their own tool calls.
+		structuredPlan, err = parseStructuredPlan(planContent)
+		if err != nil {
+			a.logger.Error("Agent: Orchestrator provided an invalid structured plan.", "error", err, "retry", retryCount)
+			if retryCount == maxPlanningRetries-1 {
+				return "", fmt.Errorf("orchestrator did not provide a valid structured plan after %d retries: %w", maxPlanningRetries, err)
+			}
+			if err := sleepContext(ctx, 1*time.Second); err != nil { // Small delay before retrying
+				return "", fmt.Errorf("orchestrator planning cancelled: %w", err)
+			}
+			continue // Retry
+		}
+
+		// 3. Identify the first action. Native tool_calls are preferred; the JSON embedded in the
+		// content is only parsed for models without function calling.
+		plannedToolCalls, err = a.planningToolCalls(message)
+		if err != nil {
+			a.logger.Error("Agent: Failed to unmarshal tool calls JSON.", "error", err, "llm_response_content", message.Content, "retry", retryCount)
+			if retryCount == maxPlanningRetries-1 {
+				return "", fmt.Errorf("failed to unmarshal tool calls JSON after %d retries: %w", maxPlanningRetries, err)
+			}
+			if err := sleepContext(ctx, 1*time.Second); err != nil { // Small delay before retrying
+				return "", fmt.Errorf("orchestrator planning cancelled: %w", err)
+			}
+			continue // Retry
+		}
+		if structuredPlan != nil {
+			plannedToolCalls = nil // The steps of a structured plan carry the tool calls
+		} else if len(plannedToolCalls) == 0 {
+			a.logger.Info("Agent: No tool calls found in Orchestrator response. Assuming direct answer or no immediate action.")
+			// If no tool calls found, it means the LLM should have provided a direct answer.
+			// We'll rely on the Nexus phase to handle the final answer or further steps.
+		}
+
+		// Tool calls parsed from the text are attached to the assistant message so that the
+		// "tool" messages answering them form a valid tool-calling transcript.
+		plannedToolCalls = a.normalizeToolCalls(plannedToolCalls)
+		message.ToolCalls = plannedToolCalls
 
 		// If plan is found, then populate a.history with the successful planning interaction.
 		// This ensures a.history is correct for the Nexus execution phase.
@@ -110,28 +500,15 @@ func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
 		a.history = append([]Message{{Role: "system", Content: getOrchestratorSystemPrompt(a.availableTools)}}, a.history...) // Add system prompt
 		a.history = append(a.history, message)                                                                                // Add the successful assistant message to history
 
-		a.currentPlan = parseNumberedList(planContent)
-		a.logger.Info("Agent: Generated plan.", "plan", strings.Join(a.currentPlan, "; "))
+		if structuredPlan != nil {
+			a.setPlan(ctx, planContent, structuredPlan.descriptions(), "")
+		} else {
+			a.setPlan(ctx, planContent, parseNumberedList(planContent), "")
+		}
 		planFound = true // Mark that a plan was successfully obtained
 
-		if foundToolCalls {
-			var parsedToolCalls []ToolCall
-			if err := json.Unmarshal([]byte(toolCallsJSONStr), &parsedToolCalls); err != nil {
-				a.logger.Error("Agent: Failed to unmarshal tool calls JSON.", "error", err, "json_string", toolCallsJSONStr, "retry", retryCount)
-				if retryCount == maxPlanningRetries-1 {
-					return "", fmt.Errorf("failed to unmarshal tool calls JSON after %d retries: %w", maxPlanningRetries, err)
-				}
-				time.Sleep(1 * time.Second) // Small delay before retrying
-				continue                    // Retry
-			}
-			if len(parsedToolCalls) > 0 {
-				firstToolCall = &parsedToolCalls[0]
-				a.logger.Info("Agent: First action is a tool call.", "tool", firstToolCall.Function.Name)
-			}
-		} else {
-			a.logger.Info("Agent: No tool calls JSON found in Orchestrator response. Assuming direct answer or no immediate action.")
-			// If no tool calls found, it means the LLM should have provided a direct answer.
-			// We'll rely on the Nexus phase to handle the final answer or further steps.
+		if len(plannedToolCalls) > 0 {
+			a.logger.Info("Agent: First action is a tool call.", "tool", plannedToolCalls[0].Function.Name, "count", len(plannedToolCalls))
 		}
 
 		break // Plan successfully generated and tool call (if any) identified, exit retry loop
@@ -142,9 +519,23 @@ func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
 		return "", fmt.Errorf("failed to obtain a parsable plan from Orchestrator after multiple retries. Last LLM content: '%s'", lastLLMContent)
 	}
 
+	// A structured plan runs all its steps up front; Nexus then writes the final answer from the results.
+	if structuredPlan != nil {
+		a.logger.Info("Agent: Executing structured plan.", "steps", len(structuredPlan.Steps))
+		if err := a.runStructuredPlan(ctx, structuredPlan); err != nil {
+			return "", err
+		}
+		message = Message{} // The planning response is not a final answer
+	}
+
 	// --- Phase 2: Nexus (Execution Loop) ---
 	a.logger.Info("Agent: Entering Nexus (Execution) phase.")
 	for {
+		if err := ctx.Err(); err != nil {
+			a.logger.Info("Agent: Execution cancelled.", "current_step_idx", a.currentStepIdx)
+			return "", fmt.Errorf("nexus execution cancelled: %w", err)
+		}
+
 		// If the LLM provided a final answer and no more tools, we're done.
 		// This check needs to be against the 'message' variable which holds the *latest* LLM response.
 		if message.Content != "" && (message.ToolCalls == nil || len(message.ToolCalls) == 0) {
@@ -159,32 +550,29 @@ func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
 			return finalSummary, nil
 		}
 
-		// Execute the tool call if one was recommended (either from planning or previous Nexus step)
-		if firstToolCall != nil { // Handle the tool call potentially generated during planning phase
-			a.logger.Info("Agent: Executing first planned tool call.", "tool", firstToolCall.Function.Name, "arguments", firstToolCall.Function.Arguments)
-			toolResult, execErr := a.executeToolCall(ctx, firstToolCall)
-			if execErr != nil {
-				toolResultMsg := Message{Role: "tool", Content: fmt.Sprintf("Tool execution failed: %v", execErr)}
-				a.logger.Error("Agent: Tool execution failed.", "tool", firstToolCall.Function.Name, "error", execErr)
-				a.history = append(a.history, toolResultMsg)
-			} else {
-				synthesizedResult, err := a.synthesizer.Synthesize(toolResult) // Use the agent's synthesizer
-				if err != nil {
-					return "", fmt.Errorf("failed to synthesize tool result: %w", err)
-				}
-				toolResultMsg := Message{Role: "tool", Content: synthesizedResult}
-				a.history = append(a.history, toolResultMsg)
-				a.logger.Info("Agent: Tool execution successful.", "tool", firstToolCall.Function.Name, "result", synthesizedResult)
+		// Execute the tool calls if any were recommended (either from planning or previous Nexus step)
+		if len(plannedToolCalls) > 0 { // Handle the tool calls potentially generated during planning phase
+			a.logger.Info("Agent: Executing planned tool calls.", "tool", plannedToolCalls[0].Function.Name, "count", len(plannedToolCalls))
+			a.startStep(ctx)
+			failure, err := a.runToolCalls(ctx, plannedToolCalls)
+			if err != nil {
+				return "", err
+			}
+			// Cleared after execution to move to Nexus-driven calls, unless a revised plan recommends more
+			if plannedToolCalls, err = a.finishStep(ctx, failure); err != nil {
+				return "", err
 			}
-			firstToolCall = nil // Clear after first execution to move to Nexus-driven calls
-			a.currentStepIdx++  // Increment step after execution
 		} else {
 			// Get the next action from Nexus based on the plan and history
 			a.logger.Info("Agent: Requesting next action from Nexus.", "current_step_idx", a.currentStepIdx, "plan_length", len(a.currentPlan))
+			a.startStep(ctx)
+			if err := a.checkStepBudget(); err != nil {
+				return "", err
+			}
 
 			// For Nexus execution, always append the system prompt to the *current* history
 			nexusMessages := append([]Message{{Role: "system", Content: getNexusSystemPrompt(a.originalQuery, a.currentPlan, a.currentStepIdx, a.availableTools)}}, a.history...)
-			currentLLMResponse, err := a.llmClient.CallChatCompletion(ctx, nexusMessages, a.availableTools) // Use temp var
+			currentLLMResponse, err := a.callLLM(ctx, nexusMessages) // Use temp var
 			if err != nil {
 				return "", fmt.Errorf("nexus execution failed: %w", err)
 			}
@@ -192,38 +580,43 @@ func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
 			// Assign to the outer-scoped message
 			llmResponse = currentLLMResponse
 			message = llmResponse.Choices[0].Message
+
+			// Nexus can report that the plan no longer fits; the calls it proposed alongside are dropped.
+			if reason, stale := extractContentBetweenTags(message.Content, "<replan>", "</replan>"); stale {
+				message.ToolCalls = nil
+				a.history = append(a.history, message)
+				if plannedToolCalls, err = a.replan(ctx, fmt.Sprintf("Nexus reported that the plan no longer applies: %s", reason)); err != nil {
+					return "", err
+				}
+				message = Message{} // A revised plan is not a final answer
+				continue
+			}
+
+			message.ToolCalls = a.normalizeToolCalls(message.ToolCalls)
 			a.history = append(a.history, message) // Add Nexus's response to history
 
 			if message.ToolCalls != nil && len(message.ToolCalls) > 0 {
-				// Nexus recommended a tool, execute it
-				a.logger.Info("Agent: Nexus recommended tool.", "tool", message.ToolCalls[0].Function.Name, "arguments", message.ToolCalls[0].Function.Arguments)
-				toolResult, execErr := a.executeToolCall(ctx, &message.ToolCalls[0])
-				if execErr != nil {
-					toolResultMsg := Message{Role: "tool", Content: fmt.Sprintf("Tool execution failed: %v", execErr)}
-					a.logger.Error("Agent: Tool execution failed.", "tool", message.ToolCalls[0].Function.Name, "error", execErr)
-					a.history = append(a.history, toolResultMsg)
-				} else {
-					synthesizedResult, err := a.synthesizer.Synthesize(toolResult) // Use the agent's synthesizer
-					if err != nil {
-						return "", fmt.Errorf("failed to synthesize tool result: %w", err)
-					}
-					toolResultMsg := Message{Role: "tool", Content: synthesizedResult}
-					a.history = append(a.history, toolResultMsg)
-					a.logger.Info("Agent: Tool execution successful.", "tool", message.ToolCalls[0].Function.Name, "result", synthesizedResult)
+				// Nexus recommended tools, execute all of them
+				a.logger.Info("Agent: Nexus recommended tools.", "tool", message.ToolCalls[0].Function.Name, "count", len(message.ToolCalls))
+				failure, err := a.runToolCalls(ctx, message.ToolCalls)
+				if err != nil {
+					return "", err
+				}
+				if plannedToolCalls, err = a.finishStep(ctx, failure); err != nil { // Advances the step after successful execution
+					return "", err
 				}
-				a.currentStepIdx++ // Increment step after successful execution
 			} else {
 				// Nexus did not recommend a tool. It might be done or stuck.
 				if llmResponse.Choices[0].FinishReason == "stop" && message.Content != "" {
 					a.logger.Info("Agent: Nexus indicated task completion with a final answer.")
 					// Optionally, use the Reconnector here for a consistent final summary
-											reconnector := NewReconnector(a.llmClient)
-						finalSummary, reconErr := reconnector.Reconnect(ctx, a.history)
-						if reconErr != nil {
-							a.logger.Error("Agent: Failed to reconnect final summary.", "error", reconErr)
-							return message.Content, fmt.Errorf("failed to get final summary, returning raw LLM content: %w", reconErr)
-						}
-						return finalSummary, nil
+					reconnector := NewReconnector(a.llmClient)
+					finalSummary, reconErr := reconnector.Reconnect(ctx, a.history)
+					if reconErr != nil {
+						a.logger.Error("Agent: Failed to reconnect final summary.", "error", reconErr)
+						return message.Content, fmt.Errorf("failed to get final summary, returning raw LLM content: %w", reconErr)
+					}
+					return finalSummary, nil
 				} else {
 					// This indicates Nexus might be stuck or unable to proceed.
 					a.logger.Warn("Agent: Nexus did not recommend a tool and did not provide a final answer. Potentially stuck.", "llm_response_content", message.Content, "finish_reason", llmResponse.Choices[0].FinishReason)
@@ -234,6 +627,18 @@ func (a *Agent) Execute(ctx context.Context, query string) (string, error) {
 	}
 }
 
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // executeToolCall is responsible for executing a tool call.
 func (a *Agent) executeToolCall(ctx context.Context, toolCall *ToolCall) (*mcpcore.CallToolResult, error) {
 	a.logger.Info("Executing tool call", "tool_name", toolCall.Function.Name, "arguments", toolCall.Function.Arguments)
@@ -309,6 +714,12 @@ Your numbered step-by-step plan here.
 **Available Tools (Concise Summary):**
 %s
 
+**Structured Plans:**
+When every step and its tool can be decided upfront, you may instead write the plan as JSON within the <plan> tags, with no tool calls JSON after it. Steps run as soon as the steps listed in "depends_on" have finished. In "arguments", "{{steps.<id>.output}}" is replaced by the output of that step, and "{{steps.<id>.output.<field>}}" by a field of its JSON output:
+<plan>
+{"steps": [{"id": "list", "description": "List the files.", "tool": "fs.list_directory", "arguments": {"path": "."}}, {"id": "read", "description": "Read the first file.", "tool": "fs.read_file", "arguments": {"path": "{{steps.list.output.items.0.path}}"}, "depends_on": ["list"]}, {"id": "answer", "description": "Summarize the file.", "depends_on": ["read"]}]}
+</plan>
+
 Example Output (for a tool-requiring task):
 <plan>
 1. Search for current weather in London using 'weather.get_current'.
@@ -326,11 +737,28 @@ Hello! How can I assist you today?`,
 	)
 }
 
+// getReplanningPrompt asks the Orchestrator persona to revise the plan, given why the current one failed.
+func getReplanningPrompt(reason string, plan []string, currentStepIdx int) string {
+	return fmt.Sprintf(`The current plan needs to be revised.
+
+**Reason:**
+%s
+
+**Current Plan (stopped at step %d):**
+%s
+
+Using the conversation so far, produce a revised plan covering only the work that remains, in the same format as before: the numbered steps within <plan> and </plan> tags, followed by the tool calls for the first step of the revised plan (or {"tool_calls": []} if no tool is needed).`,
+		reason,
+		currentStepIdx+1,
+		strings.Join(plan, "\n"),
+	)
+}
+
 // getNexusSystemPrompt continues to use the more detailed formatToolsForLLM
 func getNexusSystemPrompt(originalQuery string, plan []string, currentStepIdx int, tools []Tool) string {
 	formattedTools := formatToolsForLLM(tools) // Nexus still gets full tool details
 
-	currentPlanStep := ""
+	currentPlanStep := "All steps of the plan have been executed. Check the results in the 'Conversation History' and provide the final answer, or finish any work that failed."
 	if currentStepIdx < len(plan) {
 		currentPlanStep = plan[currentStepIdx]
 	}
@@ -355,6 +783,7 @@ func getNexusSystemPrompt(originalQuery string, plan []string, currentStepIdx in
 3.  **Error Handling:** If a tool call in the 'Conversation History' resulted in an error, analyze it. If the error prevents completing the current step, either try an alternative approach (if possible within the plan) or state that the task cannot be completed and why.
 4.  **Task Completion:** If this step completes the overall plan, or if no more tools are needed to fulfill the 'Original User Request', provide the final summary/answer. If the plan is complete and no more tools are needed, respond with {"tool_calls": []} and then your final answer.
 5.  **No Tool Needed for Current Step:** If the current step (or the overall task) doesn't require a tool, output {"tool_calls": []} and provide a direct textual response.
+6.  **Stale Plan:** If the results so far show that the plan cannot work or no longer fits the 'Original User Request', do not call a tool. Respond with <replan>why the plan no longer applies</replan> and a revised plan will be made.
 
 **Conversation History:**
 [This will be automatically appended by the LLM client, but the prompt emphasizes its importance]
@@ -472,37 +901,80 @@ func extractContentBetweenTags(text, startTag, endTag string) (string, bool) {
 	return "", false
 }
 
-// extractToolCallsJSON attempts to find and extract the first JSON array of tool calls from a string.
-// It is designed to be robust to surrounding conversational text.
-func extractToolCallsJSON(text string) (string, bool) {
-	// This regex looks for an opening curly brace '{' that is part of a JSON object (or array of objects)
-	// and tries to match until a closing curly brace '}' or square bracket ']' that balances it.
-	// This is a simplified approach and might need refinement for extremely complex or malformed JSON.
-	// For tool calls, we expect an array: [{"id": "...", "function": {...}}]
-	// So, we look for the outermost `[` and `]`
-	re := regexp.MustCompile(`(?s)\[\s*\{.*\}\s*\]`) // Matches an array containing at least one object
-
-	matches := re.FindString(text)
-	if matches != "" {
-		// Basic check for valid JSON structure
-		var temp []interface{} // Use interface{} to allow any valid JSON structure
-		if err := json.Unmarshal([]byte(matches), &temp); err == nil {
-			return matches, true
+// extractToolCallsJSON finds the tool calls a model without function calling wrote in its
+// response text and returns them as a JSON array of ToolCall. Every JSON value in the text is
+// considered, so prose and other JSON (such as a structured plan) around the tool calls are
+// ignored, and calls split over several JSON blocks are all returned. A bracketed region that
+// is not valid JSON even after repair is searched for values nested inside it. The {"tool_calls": [...]}
+// envelope is unwrapped; found is true if it is present, even when empty. Repairs are counted in repairs.
+func extractToolCallsJSON(text string, repairs *JSONRepairRecorder) (toolCallsJSON string, found bool) {
+	toolCalls := []ToolCall{}
+	for from := 0; ; {
+		candidate, ok := nextJSONCandidate(text, from)
+		if !ok {
+			break
+		}
+		from = candidate.end
+		repaired, fixes, ok := repairJSON(candidate.text)
+		if !ok {
+			if looksLikeToolCalls(candidate.text) {
+				repairs.record(JSONSourceTextToolCalls, fixes, false)
+			}
+			from = candidate.start + 1
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(repaired), &value); err != nil {
+			from = candidate.start + 1
+			continue
+		}
+		calls, isToolCalls := toolCallsFromJSON(value)
+		if !isToolCalls {
+			continue
 		}
+		repairs.record(JSONSourceTextToolCalls, fixes, true)
+		toolCalls = append(toolCalls, calls...)
+		found = true
 	}
+	if !found {
+		return "", false // No tool calls found
+	}
+	encoded, err := json.Marshal(toolCalls)
+	if err != nil {
+		return "", false
+	}
+	return string(encoded), true
+}
 
-	// If the above didn't work, try to find a single JSON object (e.g., if LLM omits the array brackets)
-	re = regexp.MustCompile(`(?s)\{.*\}`)
-	matches = re.FindString(text)
-	if matches != "" {
-		var temp map[string]interface{} // Use map for single object
-		if err := json.Unmarshal([]byte(matches), &temp); err == nil {
-			// If it's a single object, wrap it in an array to match expected ToolCalls format
-			return fmt.Sprintf("[%s]", matches), true
-		}
+// planningToolCalls returns the tool calls recommended in an Orchestrator response. Native
+// tool_calls are preferred; the JSON embedded in the content is only parsed for models
+// without function calling.
+func (a *Agent) planningToolCalls(message Message) ([]ToolCall, error) {
+	if len(message.ToolCalls) > 0 {
+		return message.ToolCalls, nil
 	}
+	toolCallsJSONStr, found := extractToolCallsJSON(message.Content, a.jsonRepairs)
+	if !found {
+		return nil, nil
+	}
+	return parseTextToolCalls(toolCallsJSONStr)
+}
 
-	return "", false // No valid JSON found
+// parseTextToolCalls unmarshals tool calls extracted from message content. Entries without a
+// function name, such as the {"tool_calls": []} marker the prompt asks for when no tool is
+// needed, are dropped.
+func parseTextToolCalls(toolCallsJSON string) ([]ToolCall, error) {
+	var parsed []ToolCall
+	if err := json.Unmarshal([]byte(toolCallsJSON), &parsed); err != nil {
+		return nil, err
+	}
+	toolCalls := parsed[:0]
+	for _, toolCall := range parsed {
+		if toolCall.Function.Name != "" {
+			toolCalls = append(toolCalls, toolCall)
+		}
+	}
+	return toolCalls, nil
 }
 
 func parseNumberedList(text string) []string {
@@ -0,0 +1,102 @@
+package go_as
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BudgetKind names the AgentBudget limit that stopped a run.
+type BudgetKind string
+
+const (
+	// BudgetMaxSteps is hit when the execution phase has asked the LLM for MaxSteps actions.
+	BudgetMaxSteps BudgetKind = "max_steps"
+	// BudgetMaxToolCalls is hit when the next tool calls would exceed MaxToolCalls.
+	BudgetMaxToolCalls BudgetKind = "max_tool_calls"
+	// BudgetMaxDuration is hit when the run has been going for longer than MaxDuration.
+	BudgetMaxDuration BudgetKind = "max_duration"
+	// BudgetRepeatedToolCall is hit when the same tool call is requested more than MaxRepeatedToolCalls times.
+	BudgetRepeatedToolCall BudgetKind = "repeated_tool_call"
+	// BudgetMaxReplans is hit when the plan would need revising more than MaxReplans times.
+	BudgetMaxReplans BudgetKind = "max_replans"
+)
+
+// BudgetExceededError is returned by Agent.Execute when a run is stopped by its AgentBudget.
+// PartialAnswer summarizes what the run had found out so far; Execute also returns it as its result.
+type BudgetExceededError struct {
+	Budget        BudgetKind
+	Detail        string
+	PartialAnswer string
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("agent budget %s exceeded: %s", e.Budget, e.Detail)
+}
+
+// checkStepBudget is called before the execution phase asks the LLM for another action.
+func (a *Agent) checkStepBudget() error {
+	if a.budget.MaxSteps > 0 && a.steps >= a.budget.MaxSteps {
+		return a.budgetExceeded(BudgetMaxSteps, fmt.Sprintf("%d steps taken", a.steps))
+	}
+	a.steps++
+	return nil
+}
+
+// checkToolCallBudget is called before a batch of tool calls runs. It counts the calls
+// and rejects the batch if it would exceed the tool call limit or repeats a call too often.
+func (a *Agent) checkToolCallBudget(toolCalls []ToolCall) error {
+	if a.budget.MaxToolCalls > 0 && a.toolCalls+len(toolCalls) > a.budget.MaxToolCalls {
+		return a.budgetExceeded(BudgetMaxToolCalls, fmt.Sprintf("%d tool calls made, %d more requested", a.toolCalls, len(toolCalls)))
+	}
+	if a.budget.MaxRepeatedToolCalls > 0 {
+		if a.seenToolCalls == nil {
+			a.seenToolCalls = make(map[string]int)
+		}
+		for _, toolCall := range toolCalls {
+			key := toolCallKey(toolCall)
+			a.seenToolCalls[key]++
+			if a.seenToolCalls[key] > a.budget.MaxRepeatedToolCalls {
+				return a.budgetExceeded(BudgetRepeatedToolCall, fmt.Sprintf("%s called %d times with arguments %s", toolCall.Function.Name, a.seenToolCalls[key], toolCall.Function.Arguments))
+			}
+		}
+	}
+	a.toolCalls += len(toolCalls)
+	return nil
+}
+
+// toolCallKey identifies a tool call by its name and arguments, ignoring JSON formatting
+// differences such as key order and whitespace.
+func toolCallKey(toolCall ToolCall) string {
+	args := toolCall.Function.Arguments
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(args), &parsed); err == nil {
+		if canonical, err := json.Marshal(parsed); err == nil { // Marshal sorts map keys
+			args = string(canonical)
+		}
+	}
+	return toolCall.Function.Name + "\x00" + args
+}
+
+// budgetExceeded builds the error for an exhausted budget, with a partial answer from the history.
+func (a *Agent) budgetExceeded(budget BudgetKind, detail string) *BudgetExceededError {
+	a.logger.Warn("Agent: Budget exceeded, stopping run.", "budget", budget, "detail", detail)
+	return &BudgetExceededError{Budget: budget, Detail: detail, PartialAnswer: a.partialAnswer(budget)}
+}
+
+// partialAnswer summarizes the tool results gathered so far for a run that could not finish.
+func (a *Agent) partialAnswer(budget BudgetKind) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "The task was stopped before it was completed (%s budget exceeded).", budget)
+	var results []string
+	for _, message := range a.history {
+		if message.Role == "tool" {
+			results = append(results, fmt.Sprintf("- %s: %s", message.Name, message.Content))
+		}
+	}
+	if len(results) > 0 {
+		builder.WriteString(" Results gathered so far:\n")
+		builder.WriteString(strings.Join(results, "\n"))
+	}
+	return builder.String()
+}
@@ -0,0 +1,90 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLoopingLLMServer returns an LLM that never finishes: every response asks for another echo call.
+// With sameArgs the calls are identical, otherwise each one echoes a new value.
+func newLoopingLLMServer(t *testing.T, sameArgs bool, delay time.Duration) *httptest.Server {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		time.Sleep(delay)
+
+		n := calls.Add(1)
+		args := `{"text": "again"}`
+		if !sameArgs {
+			args = fmt.Sprintf(`{"text": "value %d"}`, n)
+		}
+		message := Message{Role: "assistant", ToolCalls: []ToolCall{{Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: args}}}}
+		if strings.Contains(req.Messages[0].Content, "Nexus Orchestrator") {
+			message.Content = "<plan>\n1. Echo forever.\n</plan>"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "tool_calls"}}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAgentBudgets(t *testing.T) {
+	tests := []struct {
+		name       string
+		budget     AgentBudget
+		sameArgs   bool
+		delay      time.Duration
+		wantBudget BudgetKind
+	}{
+		{name: "max steps", budget: AgentBudget{MaxSteps: 2}, wantBudget: BudgetMaxSteps},
+		{name: "max tool calls", budget: AgentBudget{MaxToolCalls: 3}, wantBudget: BudgetMaxToolCalls},
+		{name: "max duration", budget: AgentBudget{MaxDuration: 200 * time.Millisecond}, delay: 20 * time.Millisecond, wantBudget: BudgetMaxDuration},
+		{name: "repeated tool call", budget: AgentBudget{MaxRepeatedToolCalls: 2}, sameArgs: true, wantBudget: BudgetRepeatedToolCall},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLLMServer := newLoopingLLMServer(t, tt.sameArgs, tt.delay)
+			logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+			llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+			echoClient, err := NewMCPClientWithConfig(&MCPConfig{Alias: "echo", Transport: MCPTransportInProcess, Server: newEchoMCPServer()}, logger)
+			require.NoError(t, err)
+			defer echoClient.Close()
+
+			agent := NewAgent(llmClient, map[string]*MCPClient{"echo": echoClient}, logger, nil)
+			agent.SetBudget(tt.budget)
+			partialAnswer, err := agent.Execute(context.Background(), "echo forever")
+
+			var budgetErr *BudgetExceededError
+			require.True(t, errors.As(err, &budgetErr), "unexpected error: %v", err)
+			assert.Equal(t, tt.wantBudget, budgetErr.Budget)
+			assert.Equal(t, budgetErr.PartialAnswer, partialAnswer)
+			assert.Contains(t, partialAnswer, string(tt.wantBudget))
+			assert.Contains(t, partialAnswer, "- echo.echo: ")
+		})
+	}
+}
+
+func TestToolCallKeyIgnoresFormatting(t *testing.T) {
+	a := ToolCall{Function: FunctionCall{Name: "fs.read_file", Arguments: `{"path": "a.txt", "encoding": "utf-8"}`}}
+	b := ToolCall{Function: FunctionCall{Name: "fs.read_file", Arguments: `{"encoding":"utf-8","path":"a.txt"}`}}
+	c := ToolCall{Function: FunctionCall{Name: "fs.read_file", Arguments: `{"path": "b.txt"}`}}
+
+	assert.Equal(t, toolCallKey(a), toolCallKey(b))
+	assert.NotEqual(t, toolCallKey(a), toolCallKey(c))
+}
@@ -0,0 +1,183 @@
+package go_as
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AgentStrategy decides how an Agent works through a task: how the LLM is prompted and when
+// tools are called. Every strategy shares the agent's tools, budget and progress updates.
+type AgentStrategy interface {
+	// Name identifies the strategy, e.g. in OrchestrationRequest.Strategy.
+	Name() string
+	// Run works through query and returns the final answer.
+	Run(ctx context.Context, agent *Agent, query string) (string, error)
+}
+
+// Names of the built-in strategies.
+const (
+	StrategyPlanExecute = "plan_execute"
+	StrategyReAct       = "react"
+	StrategyRouter      = "router"
+)
+
+// PlanExecuteStrategy has the Orchestrator persona plan the task up front and Nexus execute the
+// plan step by step, replanning when steps fail. The explicit plan keeps weaker local models on track.
+type PlanExecuteStrategy struct{}
+
+func (PlanExecuteStrategy) Name() string { return StrategyPlanExecute }
+
+func (PlanExecuteStrategy) Run(ctx context.Context, agent *Agent, query string) (string, error) {
+	return agent.planAndExecute(ctx, query)
+}
+
+// ReActStrategy is a plain function-calling loop: the model is given the tools and the
+// conversation, its tool calls are executed, and this repeats until it answers without
+// calling a tool. It relies on native tool_calls and suits strong hosted models.
+type ReActStrategy struct{}
+
+func (ReActStrategy) Name() string { return StrategyReAct }
+
+func (ReActStrategy) Run(ctx context.Context, a *Agent, query string) (string, error) {
+	a.history = []Message{
+		{Role: "system", Content: getReActSystemPrompt(a.availableTools)},
+		{Role: "user", Content: query},
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("react execution cancelled: %w", err)
+		}
+		a.startStep(ctx)
+		if err := a.checkStepBudget(); err != nil {
+			return "", err
+		}
+
+		llmResponse, err := a.callLLM(ctx, a.history)
+		if err != nil {
+			return "", fmt.Errorf("react execution failed: %w", err)
+		}
+		message := llmResponse.Choices[0].Message
+		message.ToolCalls = a.normalizeToolCalls(message.ToolCalls)
+		a.history = append(a.history, message)
+
+		if len(message.ToolCalls) == 0 {
+			if message.Content == "" {
+				return "", fmt.Errorf("react agent returned neither tool calls nor an answer")
+			}
+			return message.Content, nil
+		}
+		// Tool failures are in the history for the model to handle on its next turn.
+		if _, err := a.runToolCalls(ctx, message.ToolCalls); err != nil {
+			return "", err
+		}
+		a.currentStepIdx++
+	}
+}
+
+// RouterStrategy makes a single LLM call to pick the tool calls for the request, runs them and
+// returns their results as the answer, without another LLM call. It suits requests that map
+// to one tool, and models that cannot follow a multi-step loop; tool calls given as JSON in
+// the text are accepted for models without function calling.
+type RouterStrategy struct{}
+
+func (RouterStrategy) Name() string { return StrategyRouter }
+
+func (RouterStrategy) Run(ctx context.Context, a *Agent, query string) (string, error) {
+	a.history = []Message{
+		{Role: "system", Content: getRouterSystemPrompt(a.availableTools)},
+		{Role: "user", Content: query},
+	}
+	a.startStep(ctx)
+	if err := a.checkStepBudget(); err != nil {
+		return "", err
+	}
+
+	llmResponse, err := a.callLLM(ctx, a.history)
+	if err != nil {
+		return "", fmt.Errorf("router failed: %w", err)
+	}
+	message := llmResponse.Choices[0].Message
+	toolCalls, err := a.planningToolCalls(message)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal router tool calls JSON: %w", err)
+	}
+	if len(toolCalls) == 0 {
+		if message.Content == "" {
+			return "", fmt.Errorf("router returned neither tool calls nor an answer")
+		}
+		return message.Content, nil // The model answered directly
+	}
+
+	message.ToolCalls = a.normalizeToolCalls(toolCalls)
+	a.history = append(a.history, message)
+	failure, err := a.runToolCalls(ctx, message.ToolCalls)
+	if err != nil {
+		return "", err
+	}
+
+	results := make([]string, 0, len(message.ToolCalls))
+	for _, result := range a.history[len(a.history)-len(message.ToolCalls):] {
+		results = append(results, result.Content)
+	}
+	answer := strings.Join(results, "\n\n")
+	if failure != nil {
+		return answer, fmt.Errorf("routed tool call failed: %w", failure)
+	}
+	return answer, nil
+}
+
+// The methods below are the building blocks for AgentStrategy implementations outside this package.
+
+// Tools returns the tools available to the run, named "alias.tool".
+func (a *Agent) Tools() []Tool {
+	return a.availableTools
+}
+
+// CallLLM sends messages to the LLM with the run's tools, streaming token updates when progress
+// updates are enabled. Each call counts as a step against the run's budget.
+func (a *Agent) CallLLM(ctx context.Context, messages []Message) (*ChatCompletionResponse, error) {
+	if err := a.checkStepBudget(); err != nil {
+		return nil, err
+	}
+	return a.callLLM(ctx, messages)
+}
+
+// RunToolCalls executes toolCalls as described for an assistant message and returns one "tool"
+// message per call, in order, to append to the conversation. Tool failures are reported in the
+// messages; an error means the run cannot continue, e.g. because its budget ran out.
+// Tool calls should carry IDs so that the results can be matched to them.
+func (a *Agent) RunToolCalls(ctx context.Context, toolCalls []ToolCall) ([]Message, error) {
+	before := len(a.history)
+	if _, err := a.runToolCalls(ctx, toolCalls); err != nil {
+		return nil, err
+	}
+	return append([]Message(nil), a.history[before:]...), nil
+}
+
+// getReActSystemPrompt returns the system prompt for ReActStrategy.
+func getReActSystemPrompt(tools []Tool) string {
+	return fmt.Sprintf(`You are a capable assistant that completes the user's request by calling tools.
+
+Work step by step: call the tools you need, look at their results, and call more tools until you have what you need. Independent tool calls may be made together in one response. If a tool call fails, read the error and try another approach. When the request is complete, answer the user directly without calling a tool.
+
+**Available Tools:**
+%s`,
+		formatToolsForLLM(tools),
+	)
+}
+
+// getRouterSystemPrompt returns the system prompt for RouterStrategy.
+func getRouterSystemPrompt(tools []Tool) string {
+	return fmt.Sprintf(`You are a tool router. Choose the tool call (or independent tool calls) that answers the user's request in one go. The results of the calls are given to the user as they are.
+
+If your model does not support function calling, respond only with the JSON:
+{"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "tool.name", "arguments": "{\"param\":\"value\"}"}}]}
+
+If no tool fits the request, answer it directly instead.
+
+**Available Tools:**
+%s`,
+		formatToolsForLLM(tools),
+	)
+}
@@ -0,0 +1,137 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStrategyTestAgent returns an agent with the echo tool whose LLM answers with responses in order.
+func newStrategyTestAgent(t *testing.T, responses []Message, requests *[][]Message) *Agent {
+	var calls atomic.Int32
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		*requests = append(*requests, req.Messages)
+
+		n := int(calls.Add(1))
+		require.LessOrEqual(t, n, len(responses), "unexpected LLM call")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: responses[n-1], FinishReason: "stop"}}})
+	}))
+	t.Cleanup(mockLLMServer.Close)
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+	echoClient, err := NewMCPClientWithConfig(&MCPConfig{Alias: "echo", Transport: MCPTransportInProcess, Server: newEchoMCPServer()}, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { echoClient.Close() })
+
+	availableTools := []Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo", Parameters: json.RawMessage(`{"type": "object"}`)}}}
+	return NewAgent(llmClient, map[string]*MCPClient{"echo": echoClient}, logger, availableTools)
+}
+
+func TestReActStrategy(t *testing.T) {
+	var requests [][]Message
+	agent := newStrategyTestAgent(t, []Message{
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "one"}`}}}},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_2", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "two"}`}}}},
+		{Role: "assistant", Content: "Final answer"},
+	}, &requests)
+	agent.SetStrategy(ReActStrategy{})
+
+	finalResult, err := agent.Execute(context.Background(), "echo twice")
+	require.NoError(t, err)
+	assert.Equal(t, "Final answer", finalResult)
+	assert.Equal(t, StrategyReAct, agent.Record().Strategy)
+
+	require.Len(t, requests, 3)
+	assert.Contains(t, requests[0][0].Content, "completes the user's request by calling tools")
+	last := requests[2]
+	assertValidToolTranscript(t, last)
+	assert.Equal(t, "two", last[len(last)-1].Content)
+}
+
+func TestRouterStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		response Message
+		want     string
+	}{
+		{
+			name:     "native tool call",
+			response: Message{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "routed"}`}}}},
+			want:     "routed",
+		},
+		{
+			name:     "text tool call",
+			response: Message{Role: "assistant", Content: `{"tool_calls": [{"function": {"name": "echo.echo", "arguments": "{\"text\": \"routed\"}"}}]}`},
+			want:     "routed",
+		},
+		{
+			name:     "direct answer",
+			response: Message{Role: "assistant", Content: "No tool needed."},
+			want:     "No tool needed.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests [][]Message
+			agent := newStrategyTestAgent(t, []Message{tt.response}, &requests)
+			agent.SetStrategy(RouterStrategy{})
+
+			finalResult, err := agent.Execute(context.Background(), "route this")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, finalResult)
+			assert.Len(t, requests, 1)
+		})
+	}
+}
+
+func TestExecuteTaskSelectsStrategy(t *testing.T) {
+	var systemPrompts []string
+	orchestrator := newTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		systemPrompts = append(systemPrompts, req.Messages[0].Content)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: Message{Role: "assistant", Content: "Hello!"}, FinishReason: "stop"}}})
+	})
+
+	run := func(request *OrchestrationRequest) OrchestrationUpdate {
+		updates := make(chan OrchestrationUpdate, 100)
+		go orchestrator.ExecuteTask(context.Background(), request, updates)
+		var last OrchestrationUpdate
+		for update := range updates {
+			last = update
+		}
+		return last
+	}
+
+	last := run(&OrchestrationRequest{Query: "hi", Strategy: StrategyRouter})
+	assert.Equal(t, UpdateTypeResult, last.Type)
+	assert.Equal(t, "Hello!", last.Content)
+	require.Len(t, systemPrompts, 1)
+	assert.True(t, strings.HasPrefix(systemPrompts[0], "You are a tool router."))
+
+	last = run(&OrchestrationRequest{Query: "hi", Strategy: "unknown"})
+	assert.Equal(t, UpdateTypeError, last.Type)
+	assert.Contains(t, last.Content, `unknown agent strategy "unknown"`)
+
+	orchestrator.config.DefaultStrategy = StrategyReAct
+	last = run(&OrchestrationRequest{Query: "hi"})
+	assert.Equal(t, UpdateTypeResult, last.Type)
+	require.Len(t, systemPrompts, 2)
+	assert.Contains(t, systemPrompts[1], "completes the user's request by calling tools")
+}
@@ -3,11 +3,14 @@ package go_as
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,6 +18,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	mcpcore "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
 )
 
 func TestAgentExecution(t *testing.T) {
@@ -28,11 +32,7 @@ func TestAgentExecution(t *testing.T) {
 		if strings.Contains(req.Messages[0].Content, "Nexus Orchestrator") {
 			// Phase 1: Orchestrator (Planning)
 			resp = ChatCompletionResponse{
-				Choices: []struct {
-					Message      Message `json:"message"`
-					FinishReason string  `json:"finish_reason"`
-					Index        int     `json:"index"`
-				}{
+				Choices: []ChatCompletionChoice{
 					{
 						Message: Message{
 							Role:    "assistant",
@@ -58,11 +58,7 @@ func TestAgentExecution(t *testing.T) {
 		} else if strings.Contains(req.Messages[0].Content, "Nexus") {
 			// Phase 2: Nexus (Execution)
 			resp = ChatCompletionResponse{
-				Choices: []struct {
-					Message      Message `json:"message"`
-					FinishReason string  `json:"finish_reason"`
-					Index        int     `json:"index"`
-				}{
+				Choices: []ChatCompletionChoice{
 					{
 						Message: Message{
 							Role:    "assistant",
@@ -77,11 +73,7 @@ func TestAgentExecution(t *testing.T) {
 		} else {
 			// Reconnector phase
 			resp = ChatCompletionResponse{
-				Choices: []struct {
-					Message      Message `json:"message"`
-					FinishReason string  `json:"finish_reason"`
-					Index        int     `json:"index"`
-				}{
+				Choices: []ChatCompletionChoice{
 					{
 						Message: Message{
 							Role:    "assistant",
@@ -100,19 +92,20 @@ func TestAgentExecution(t *testing.T) {
 	}))
 	defer mockLLMServer.Close()
 
-	// Mock MCP Client
-	mockMCPClient := &MCPClient{
-		callToolFunc: func(ctx context.Context, toolName string, args interface{}) (*mcpcore.CallToolResult, error) {
-			assert.Equal(t, "list_directory", toolName)
-			assert.Equal(t, map[string]interface{}{"path": "."}, args)
-			return &mcpcore.CallToolResult{
-				IsError: false,
-				Content: []mcpcore.Content{
-					mcpcore.TextContent{Text: "file1.txt"},
-				},
-			}, nil
+	// In-process MCP server standing in for the filesystem agent
+	toolCalled := false
+	fsServer := mcpserver.NewMCPServer("fs", "1.0.0", mcpserver.WithToolCapabilities(true))
+	fsServer.AddTool(
+		mcpcore.NewTool("list_directory",
+			mcpcore.WithDescription("Lists files in a directory."),
+			mcpcore.WithString("path", mcpcore.Required()),
+		),
+		func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+			assert.Equal(t, map[string]interface{}{"path": "."}, request.GetArguments())
+			toolCalled = true
+			return mcpcore.NewToolResultText("file1.txt"), nil
 		},
-	}
+	)
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	llmConfig := &LLMClientConfig{
@@ -122,6 +115,10 @@ func TestAgentExecution(t *testing.T) {
 	}
 	llmClient := NewLLMClient(llmConfig, logger)
 
+	mockMCPClient, err := NewMCPClientWithConfig(&MCPConfig{Alias: "fs", Transport: MCPTransportInProcess, Server: fsServer}, logger)
+	require.NoError(t, err)
+	defer mockMCPClient.Close()
+
 	mcpClients := map[string]*MCPClient{"fs": mockMCPClient}
 	availableTools := []Tool{
 		{
@@ -139,6 +136,7 @@ func TestAgentExecution(t *testing.T) {
 
 	require.NoError(t, err)
 	assert.Equal(t, "Final answer", finalResult)
+	assert.True(t, toolCalled, "native tool call from the planning response was not executed")
 }
 
 func TestExtractContentBetweenTags(t *testing.T) {
@@ -191,4 +189,552 @@ func TestExtractContentBetweenTags(t *testing.T) {
 			assert.Equal(t, tc.expectedFound, found)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestExtractToolCallsJSON(t *testing.T) {
+	echo := func(id, text string) ToolCall {
+		return ToolCall{ID: id, Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "` + text + `"}`}}
+	}
+	testCases := []struct {
+		name          string
+		text          string
+		expected      []ToolCall
+		expectedFound bool
+	}{
+		{
+			name:          "Envelope",
+			text:          `{"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"a\"}"}}]}`,
+			expected:      []ToolCall{echo("call_1", "a")},
+			expectedFound: true,
+		},
+		{
+			name:          "Empty envelope",
+			text:          "<plan>\n1. Provide a direct answer.\n</plan>\n{\"tool_calls\": []}\nHello!",
+			expected:      []ToolCall{},
+			expectedFound: true,
+		},
+		{
+			name: "Prose with brackets after the JSON",
+			text: `I will echo it. {"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"a\"}"}}]}
+Then I'll look at the result [if any] and use {placeholders} like this.`,
+			expected:      []ToolCall{echo("call_1", "a")},
+			expectedFound: true,
+		},
+		{
+			name:          "Bare array",
+			text:          `[{"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"a\"}"}}]`,
+			expected:      []ToolCall{echo("call_1", "a")},
+			expectedFound: true,
+		},
+		{
+			name:          "Single object",
+			text:          `Calling: {"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"a\"}"}} now.`,
+			expected:      []ToolCall{echo("call_1", "a")},
+			expectedFound: true,
+		},
+		{
+			name:          "Flat call with object arguments",
+			text:          `{"name": "echo.echo", "arguments": {"text": "a"}}`,
+			expected:      []ToolCall{{Function: FunctionCall{Name: "echo.echo", Arguments: `{"text":"a"}`}}},
+			expectedFound: true,
+		},
+		{
+			name: "Several blocks",
+			text: "First:\n```json\n{\"tool_calls\": [{\"id\": \"call_1\", \"type\": \"function\", \"function\": {\"name\": \"echo.echo\", \"arguments\": \"{\\\"text\\\": \\\"a\\\"}\"}}]}\n```\n" +
+				"Second:\n```json\n{\"tool_calls\": [{\"id\": \"call_2\", \"type\": \"function\", \"function\": {\"name\": \"echo.echo\", \"arguments\": \"{\\\"text\\\": \\\"b\\\"}\"}}]}\n```",
+			expected:      []ToolCall{echo("call_1", "a"), echo("call_2", "b")},
+			expectedFound: true,
+		},
+		{
+			name:          "Braces inside strings",
+			text:          `{"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"}]{[\"}"}}]} done`,
+			expected:      []ToolCall{echo("call_1", "}]{[")},
+			expectedFound: true,
+		},
+		{
+			name:          "Structured plan is not a tool call",
+			text:          `<plan>{"steps": [{"id": "a", "tool": "echo.echo", "arguments": {"text": "a"}}]}</plan>`,
+			expectedFound: false,
+		},
+		{
+			name:          "Repaired JSON",
+			text:          `{'tool_calls': [{'id': 'call_1', 'type': 'function', 'function': {'name': 'echo.echo', 'arguments': '{"text": "a"}'},},]}`,
+			expected:      []ToolCall{echo("call_1", "a")},
+			expectedFound: true,
+		},
+		{
+			name:          "Unbalanced prefix",
+			text:          `Oops { [ let me retry: {"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"a\"}"}}]}`,
+			expected:      []ToolCall{echo("call_1", "a")},
+			expectedFound: true,
+		},
+		{
+			name:          "Truncated JSON",
+			text:          `{"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "echo.echo"`,
+			expectedFound: false,
+		},
+		{
+			name:          "Prose only",
+			text:          "The answer is {42} [citation needed].",
+			expectedFound: false,
+		},
+		{
+			name:          "Apostrophes in prose",
+			text:          `I'll check [it's fine] {"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"a\"}"}}]} and [that's it].`,
+			expected:      []ToolCall{echo("call_1", "a")},
+			expectedFound: true,
+		},
+		{
+			name:          "Valid call inside invalid JSON",
+			text:          `{"plan": step one, "calls": [{"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"a\"}"}}]}`,
+			expected:      []ToolCall{echo("call_1", "a")},
+			expectedFound: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, found := extractToolCallsJSON(tc.text, nil)
+			assert.Equal(t, tc.expectedFound, found)
+			if !tc.expectedFound {
+				assert.Empty(t, actual)
+				return
+			}
+			var toolCalls []ToolCall
+			require.NoError(t, json.Unmarshal([]byte(actual), &toolCalls))
+			assert.Equal(t, tc.expected, toolCalls)
+		})
+	}
+}
+
+func TestAgentExecutionEmitsUpdates(t *testing.T) {
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+
+		if strings.Contains(req.Messages[0].Content, "Nexus Orchestrator") {
+			// Planning: a server that ignores the stream flag and answers with plain JSON
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{
+				Message: Message{
+					Role:    "assistant",
+					Content: "<plan>\n1. Echo the text.\n2. Answer.\n</plan>",
+					ToolCalls: []ToolCall{{
+						ID:       "call_1",
+						Type:     "function",
+						Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "hi"}`},
+					}},
+				},
+				FinishReason: "stop",
+			}}})
+			return
+		}
+
+		// Nexus: a real event stream
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"Final ", "answer"} {
+			chunk, _ := json.Marshal(map[string]interface{}{
+				"choices": []map[string]interface{}{{"delta": map[string]string{"content": delta}}},
+			})
+			w.Write([]byte("data: " + string(chunk) + "\n\n"))
+		}
+		w.Write([]byte(`data: {"choices": [{"delta": {}, "finish_reason": "stop"}]}` + "\n\ndata: [DONE]\n\n"))
+	}))
+	defer mockLLMServer.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+
+	echoClient, err := NewMCPClientWithConfig(&MCPConfig{Alias: "echo", Transport: MCPTransportInProcess, Server: newEchoMCPServer()}, logger)
+	require.NoError(t, err)
+	defer echoClient.Close()
+
+	availableTools := []Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo", Parameters: json.RawMessage(`{"type": "object"}`)}}}
+	agent := NewAgent(llmClient, map[string]*MCPClient{"echo": echoClient}, logger, availableTools)
+	updates := make(chan OrchestrationUpdate, 100)
+	agent.SetUpdateChannel(updates)
+
+	finalResult, err := agent.Execute(context.Background(), "echo hi")
+	require.NoError(t, err)
+	assert.Equal(t, "Final answer", finalResult)
+	close(updates)
+
+	var got []OrchestrationUpdate
+	for update := range updates {
+		got = append(got, update)
+	}
+	var types []string
+	for _, update := range got {
+		types = append(types, update.Type)
+	}
+	assert.Equal(t, []string{
+		UpdateTypeToken, UpdateTypePlan,
+		UpdateTypeStepStarted, UpdateTypeToolCall, UpdateTypeToolResult,
+		UpdateTypeStepStarted, UpdateTypeToken, UpdateTypeToken,
+	}, types)
+
+	assert.Equal(t, []string{"Echo the text.", "Answer."}, got[1].Plan)
+	assert.Equal(t, 1, got[2].Step)
+	assert.Equal(t, "echo.echo", got[3].Tool)
+	assert.Equal(t, `{"text": "hi"}`, got[3].Arguments)
+	assert.Equal(t, "hi", got[4].Content)
+	assert.Equal(t, 2, got[5].Step)
+	assert.Equal(t, "Answer.", got[5].Content)
+	assert.Equal(t, "Final ", got[6].Content)
+}
+
+func TestAgentExecuteStopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first planning attempt and cancel while the agent waits to retry.
+		cancel()
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer mockLLMServer.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+	agent := NewAgent(llmClient, map[string]*MCPClient{}, logger, nil)
+
+	start := time.Now()
+	_, err := agent.Execute(ctx, "anything")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestAgentPlanningToolCalls(t *testing.T) {
+	tests := []struct {
+		name       string
+		planning   Message
+		wantCalled bool
+	}{
+		{
+			name: "native tool calls",
+			planning: Message{
+				Role:      "assistant",
+				Content:   "<plan>\n1. Echo the text.\n</plan>",
+				ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "hi"}`}}},
+			},
+			wantCalled: true,
+		},
+		{
+			name: "text fallback",
+			planning: Message{
+				Role:    "assistant",
+				Content: "<plan>\n1. Echo the text.\n</plan>\n" + `{"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "echo.echo", "arguments": "{\"text\": \"hi\"}"}}]}`,
+			},
+			wantCalled: true,
+		},
+		{
+			name: "direct answer",
+			planning: Message{
+				Role:    "assistant",
+				Content: "<plan>\n1. Provide a direct answer.\n</plan>\n" + `{"tool_calls": []}` + "\nHello!",
+			},
+			wantCalled: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req ChatCompletionRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+				message := Message{Role: "assistant", Content: "Final answer"}
+				if strings.Contains(req.Messages[0].Content, "Nexus Orchestrator") {
+					message = tt.planning
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+			}))
+			defer mockLLMServer.Close()
+
+			called := false
+			echoServer := mcpserver.NewMCPServer("echo", "1.0.0")
+			echoServer.AddTool(mcpcore.NewTool("echo", mcpcore.WithString("text")), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+				called = true
+				return mcpcore.NewToolResultText(request.GetString("text", "")), nil
+			})
+
+			logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+			llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+			echoClient, err := NewMCPClientWithConfig(&MCPConfig{Alias: "echo", Transport: MCPTransportInProcess, Server: echoServer}, logger)
+			require.NoError(t, err)
+			defer echoClient.Close()
+
+			availableTools := []Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo", Parameters: json.RawMessage(`{"type": "object"}`)}}}
+			agent := NewAgent(llmClient, map[string]*MCPClient{"echo": echoClient}, logger, availableTools)
+
+			_, err = agent.Execute(context.Background(), "echo hi")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCalled, called)
+		})
+	}
+}
+
+func TestAgentRunsAllToolCalls(t *testing.T) {
+	var nexusRequests [][]Message
+	var mu sync.Mutex
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		message := Message{Role: "assistant", Content: "Final answer"}
+		switch {
+		case strings.Contains(req.Messages[0].Content, "Nexus Orchestrator"):
+			message = Message{Role: "assistant", Content: "<plan>\n1. Gather both values.\n2. Answer.\n</plan>", ToolCalls: []ToolCall{
+				{ID: "call_a1", Type: "function", Function: FunctionCall{Name: "a.wait", Arguments: `{}`}},
+				{ID: "call_b1", Type: "function", Function: FunctionCall{Name: "b.signal", Arguments: `{}`}},
+				{ID: "call_a2", Type: "function", Function: FunctionCall{Name: "a.after", Arguments: `{}`}},
+			}}
+		case strings.Contains(req.Messages[0].Content, "Nexus"):
+			mu.Lock()
+			nexusRequests = append(nexusRequests, req.Messages)
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+	}))
+	defer mockLLMServer.Close()
+
+	// a.wait only returns once b.signal has run, so the test fails unless calls to different agents overlap.
+	signalled := make(chan struct{})
+	var order []string
+	serverA := mcpserver.NewMCPServer("a", "1.0.0")
+	serverA.AddTool(mcpcore.NewTool("wait"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		select {
+		case <-signalled:
+		case <-time.After(2 * time.Second):
+			return mcpcore.NewToolResultError("b.signal did not run concurrently"), nil
+		}
+		order = append(order, "wait")
+		return mcpcore.NewToolResultText("waited"), nil
+	})
+	serverA.AddTool(mcpcore.NewTool("after"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		order = append(order, "after")
+		return mcpcore.NewToolResultText("after"), nil
+	})
+	serverB := mcpserver.NewMCPServer("b", "1.0.0")
+	serverB.AddTool(mcpcore.NewTool("signal"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		close(signalled)
+		return mcpcore.NewToolResultText("signalled"), nil
+	})
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+	mcpClients := map[string]*MCPClient{}
+	for alias, server := range map[string]*mcpserver.MCPServer{"a": serverA, "b": serverB} {
+		client, err := NewMCPClientWithConfig(&MCPConfig{Alias: alias, Transport: MCPTransportInProcess, Server: server}, logger)
+		require.NoError(t, err)
+		defer client.Close()
+		mcpClients[alias] = client
+	}
+
+	agent := NewAgent(llmClient, mcpClients, logger, nil)
+	finalResult, err := agent.Execute(context.Background(), "gather both values")
+	require.NoError(t, err)
+	assert.Equal(t, "Final answer", finalResult)
+
+	// Calls to the same agent keep their order.
+	assert.Equal(t, []string{"wait", "after"}, order)
+
+	require.Len(t, nexusRequests, 1)
+	history := nexusRequests[0]
+	assertValidToolTranscript(t, history)
+	toolMessages := history[len(history)-3:]
+	for i, want := range []struct{ id, content string }{{"call_a1", "waited"}, {"call_b1", "signalled"}, {"call_a2", "after"}} {
+		assert.Equal(t, "tool", toolMessages[i].Role)
+		assert.Equal(t, want.id, toolMessages[i].ToolCallID)
+		assert.Equal(t, want.content, toolMessages[i].Content)
+	}
+}
+
+// assertValidToolTranscript checks that every assistant message with tool calls is
+// immediately followed by one "tool" message per call, in order, as OpenAI-compatible servers require.
+func assertValidToolTranscript(t *testing.T, messages []Message) {
+	t.Helper()
+	for i, message := range messages {
+		if message.Role == "tool" {
+			require.Greater(t, i, 0, "tool message without a preceding assistant message")
+		}
+		if message.Role != "assistant" || len(message.ToolCalls) == 0 {
+			continue
+		}
+		require.GreaterOrEqual(t, len(messages), i+1+len(message.ToolCalls), "missing tool messages")
+		for j, toolCall := range message.ToolCalls {
+			assert.NotEmpty(t, toolCall.ID)
+			assert.Equal(t, "function", toolCall.Type)
+			result := messages[i+1+j]
+			assert.Equal(t, "tool", result.Role)
+			assert.Equal(t, toolCall.ID, result.ToolCallID)
+			assert.Equal(t, toolCall.Function.Name, result.Name)
+		}
+	}
+}
+
+func TestAgentHistoryIsValidToolTranscript(t *testing.T) {
+	var nexusRequests [][]Message
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		var message Message
+		switch {
+		case strings.Contains(req.Messages[0].Content, "Nexus Orchestrator"):
+			// A model without function calling: tool calls without IDs in the text
+			message = Message{Role: "assistant", Content: "<plan>\n1. Echo twice.\n2. Echo again.\n</plan>\n" +
+				`{"tool_calls": [{"function": {"name": "echo.echo", "arguments": "{\"text\": \"one\"}"}}, {"function": {"name": "echo.echo", "arguments": "{\"text\": \"two\"}"}}]}`}
+		case len(nexusRequests) == 0:
+			nexusRequests = append(nexusRequests, req.Messages)
+			// A model with function calling that omits the ID
+			message = Message{Role: "assistant", ToolCalls: []ToolCall{{Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "three"}`}}}}
+		default:
+			nexusRequests = append(nexusRequests, req.Messages)
+			message = Message{Role: "assistant", Content: "Final answer"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+	}))
+	defer mockLLMServer.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+	echoClient, err := NewMCPClientWithConfig(&MCPConfig{Alias: "echo", Transport: MCPTransportInProcess, Server: newEchoMCPServer()}, logger)
+	require.NoError(t, err)
+	defer echoClient.Close()
+
+	agent := NewAgent(llmClient, map[string]*MCPClient{"echo": echoClient}, logger, nil)
+	finalResult, err := agent.Execute(context.Background(), "echo three times")
+	require.NoError(t, err)
+	assert.Equal(t, "Final answer", finalResult)
+
+	require.Len(t, nexusRequests, 2)
+	history := nexusRequests[1]
+	assertValidToolTranscript(t, history)
+
+	var ids []string
+	var contents []string
+	for _, message := range history {
+		if message.Role == "tool" {
+			ids = append(ids, message.ToolCallID)
+			contents = append(contents, message.Content)
+		}
+	}
+	assert.Equal(t, []string{"call_1", "call_2", "call_3"}, ids)
+	assert.Equal(t, []string{"one", "two", "three"}, contents)
+}
+
+func TestAgentReplanning(t *testing.T) {
+	echoCall := func(text string) []ToolCall {
+		return []ToolCall{{Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: fmt.Sprintf(`{"text": %q}`, text)}}}
+	}
+	missingCall := []ToolCall{{Type: "function", Function: FunctionCall{Name: "echo.missing", Arguments: `{}`}}}
+
+	tests := []struct {
+		name        string
+		budget      AgentBudget
+		plan        Message   // Initial planning response
+		nexus       []Message // Nexus responses in order; the last one repeats
+		replan      Message   // Response to every replanning request
+		wantReason  string
+		wantBudget  BudgetKind
+		wantReplans int
+	}{
+		{
+			name:        "step keeps failing",
+			budget:      DefaultAgentBudget(),
+			plan:        Message{Role: "assistant", Content: "<plan>\n1. Call the missing tool.\n</plan>", ToolCalls: missingCall},
+			nexus:       []Message{{Role: "assistant", ToolCalls: missingCall}, {Role: "assistant", Content: "Final answer"}},
+			replan:      Message{Role: "assistant", Content: "<plan>\n1. Echo instead.\n</plan>", ToolCalls: echoCall("instead")},
+			wantReason:  "step 1 failed 2 times",
+			wantReplans: 1,
+		},
+		{
+			name:        "nexus reports a stale plan",
+			budget:      DefaultAgentBudget(),
+			plan:        Message{Role: "assistant", Content: "<plan>\n1. Echo a.\n2. Echo b.\n</plan>", ToolCalls: echoCall("a")},
+			nexus:       []Message{{Role: "assistant", Content: "<replan>a already covers b</replan>", ToolCalls: echoCall("b")}, {Role: "assistant", Content: "Final answer"}},
+			replan:      Message{Role: "assistant", Content: "<plan>\n1. Answer.\n</plan>"},
+			wantReason:  "a already covers b",
+			wantReplans: 1,
+		},
+		{
+			name:        "replan budget",
+			budget:      AgentBudget{MaxReplans: 2},
+			plan:        Message{Role: "assistant", Content: "<plan>\n1. Echo a.\n</plan>", ToolCalls: echoCall("a")},
+			nexus:       []Message{{Role: "assistant", Content: "<replan>still wrong</replan>"}},
+			replan:      Message{Role: "assistant", Content: "<plan>\n1. Try again.\n</plan>"},
+			wantReason:  "still wrong",
+			wantBudget:  BudgetMaxReplans,
+			wantReplans: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nexusCalls := 0
+			mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req ChatCompletionRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+				var message Message
+				switch last := req.Messages[len(req.Messages)-1]; {
+				case last.Role == "user" && strings.Contains(last.Content, "plan needs to be revised"):
+					assert.Contains(t, last.Content, tt.wantReason)
+					message = tt.replan
+				case strings.Contains(req.Messages[0].Content, "Nexus Orchestrator"):
+					message = tt.plan
+				default:
+					message = tt.nexus[min(nexusCalls, len(tt.nexus)-1)]
+					nexusCalls++
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+			}))
+			defer mockLLMServer.Close()
+
+			logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+			llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+			echoClient, err := NewMCPClientWithConfig(&MCPConfig{Alias: "echo", Transport: MCPTransportInProcess, Server: newEchoMCPServer()}, logger)
+			require.NoError(t, err)
+			defer echoClient.Close()
+
+			agent := NewAgent(llmClient, map[string]*MCPClient{"echo": echoClient}, logger, nil)
+			agent.SetBudget(tt.budget)
+			updates := make(chan OrchestrationUpdate, 100)
+			agent.SetUpdateChannel(updates)
+
+			finalResult, err := agent.Execute(context.Background(), "echo things")
+			close(updates)
+			if tt.wantBudget != "" {
+				var budgetErr *BudgetExceededError
+				require.True(t, errors.As(err, &budgetErr), "unexpected error: %v", err)
+				assert.Equal(t, tt.wantBudget, budgetErr.Budget)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "Final answer", finalResult)
+			}
+
+			record := agent.Record()
+			require.Len(t, record.Plans, tt.wantReplans+1)
+			assert.Empty(t, record.Plans[0].Reason)
+			assert.Equal(t, "test-model", record.Plans[0].Model)
+			for i, plan := range record.Plans[1:] {
+				assert.Equal(t, i+2, plan.Version)
+				assert.Contains(t, plan.Reason, tt.wantReason)
+			}
+
+			var planVersions []int
+			for update := range updates {
+				if update.Type == UpdateTypePlan {
+					planVersions = append(planVersions, update.PlanVersion)
+				}
+			}
+			assert.Len(t, planVersions, tt.wantReplans+1)
+			assert.Equal(t, tt.wantReplans+1, planVersions[len(planVersions)-1])
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package go_as
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultAnthropicURL is the Anthropic Messages API endpoint.
+const DefaultAnthropicURL = "https://api.anthropic.com/v1/messages"
+
+// AnthropicClientConfig holds configuration for the Anthropic Messages API client.
+type AnthropicClientConfig struct {
+	ServerURL string // Messages endpoint; empty uses DefaultAnthropicURL
+	APIKey    string
+	ModelName string
+	Timeout   time.Duration
+	MaxTokens int             // Required by the API; 0 uses 4096
+	Version   string          // anthropic-version header; empty uses "2023-06-01"
+	Retry     *LLMRetryPolicy // Retries of failed requests; nil uses DefaultLLMRetryPolicy
+}
+
+// AnthropicClient is an LLMProvider that speaks the Anthropic Messages API natively.
+// Tool calls and results are sent as tool_use and tool_result content blocks, system
+// messages become the request's system prompt, and stop reasons are mapped to the
+// OpenAI finish reasons the agent understands.
+type AnthropicClient struct {
+	config *AnthropicClientConfig
+	logger *slog.Logger
+	client *http.Client
+}
+
+// NewAnthropicClient creates a new AnthropicClient.
+func NewAnthropicClient(config *AnthropicClientConfig, logger *slog.Logger) *AnthropicClient {
+	return &AnthropicClient{
+		config: config,
+		logger: logger,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// anthropicRequest is the request body of the Messages API.
+type anthropicRequest struct {
+	Model      string             `json:"model"`
+	System     string             `json:"system,omitempty"`
+	Messages   []anthropicMessage `json:"messages"`
+	Tools      []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice interface{}        `json:"tool_choice,omitempty"`
+	MaxTokens  int                `json:"max_tokens"`
+	Stream     bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+// anthropicContentBlock is a text, tool_use or tool_result content block.
+type anthropicContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`          // tool_use
+	Name      string          `json:"name,omitempty"`        // tool_use
+	Input     json.RawMessage `json:"input,omitempty"`       // tool_use
+	ToolUseID string          `json:"tool_use_id,omitempty"` // tool_result
+	Content   string          `json:"content,omitempty"`     // tool_result
+	IsError   bool            `json:"is_error,omitempty"`    // tool_result
+}
+
+type anthropicTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+// anthropicResponse is the response body of the Messages API.
+type anthropicResponse struct {
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+}
+
+// anthropicStreamEvent is the data of one server-sent event of a streamed response.
+type anthropicStreamEvent struct {
+	Type         string                `json:"type"`
+	Index        int                   `json:"index"`
+	ContentBlock anthropicContentBlock `json:"content_block"` // content_block_start
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`         // text_delta
+		PartialJSON string `json:"partial_json"` // input_json_delta
+		StopReason  string `json:"stop_reason"`  // message_delta
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// maxAnthropicResumes bounds how many times a turn paused by the API (stop_reason
+// "pause_turn") is resumed before the paused response is returned as it is.
+const maxAnthropicResumes = 5
+
+// anthropicToolNamePattern matches the characters not allowed in Anthropic tool names.
+var anthropicToolNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// anthropicMaxToolNameLength is the longest tool name the Messages API accepts.
+const anthropicMaxToolNameLength = 64
+
+// anthropicToolNames maps the package's "alias.tool" names, which the Messages API does not
+// accept, to names it does, and back.
+type anthropicToolNames struct {
+	toAPI   map[string]string
+	fromAPI map[string]string
+}
+
+func newAnthropicToolNames() *anthropicToolNames {
+	return &anthropicToolNames{toAPI: make(map[string]string), fromAPI: make(map[string]string)}
+}
+
+// apiName returns the Messages API name for name. Names that are too long are truncated
+// and end in a hash of the full name, so that names sharing a long prefix stay distinct.
+// Two names that still map to the same API name are an error, since the tool calls made
+// with it could not be told apart.
+func (n *anthropicToolNames) apiName(name string) (string, error) {
+	if apiName, ok := n.toAPI[name]; ok {
+		return apiName, nil
+	}
+	apiName := anthropicToolNamePattern.ReplaceAllString(strings.ReplaceAll(name, ".", "__"), "_")
+	if len(apiName) > anthropicMaxToolNameLength {
+		sum := sha256.Sum256([]byte(name))
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		apiName = apiName[:anthropicMaxToolNameLength-len(suffix)] + suffix
+	}
+	if other, ok := n.fromAPI[apiName]; ok {
+		return "", fmt.Errorf("tools %q and %q both map to the Anthropic tool name %q", other, name, apiName)
+	}
+	n.toAPI[name] = apiName
+	n.fromAPI[apiName] = name
+	return apiName, nil
+}
+
+func (n *anthropicToolNames) name(apiName string) string {
+	if name, ok := n.fromAPI[apiName]; ok {
+		return name
+	}
+	return apiName
+}
+
+// CallChatCompletion sends a Messages API request and converts the response.
+func (c *AnthropicClient) CallChatCompletion(ctx context.Context, messages []Message, tools []Tool) (*ChatCompletionResponse, error) {
+	return c.send(ctx, messages, tools, nil, false, nil)
+}
+
+// StreamChatCompletionWithToolChoice sends a streaming Messages API request and assembles the
+// streamed text and tool_use blocks into a ChatCompletionResponse. onDelta is called with every
+// text fragment as it arrives.
+func (c *AnthropicClient) StreamChatCompletionWithToolChoice(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, onDelta func(string)) (*ChatCompletionResponse, error) {
+	return c.send(ctx, messages, tools, toolChoice, true, onDelta)
+}
+
+// send sends the request and converts the response. A turn the API pauses, as it may during
+// long-running server tools, is resumed by sending the paused response back as the start of
+// the assistant turn, and the content of every part is returned together.
+func (c *AnthropicClient) send(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, stream bool, onDelta func(string)) (*ChatCompletionResponse, error) {
+	names := newAnthropicToolNames()
+	request, err := c.buildRequest(messages, tools, toolChoice, names)
+	if err != nil {
+		return nil, err
+	}
+	request.Stream = stream
+
+	var turn anthropicResponse
+	for resumes := 0; ; resumes++ {
+		anthropicResp, err := c.post(ctx, request, onDelta)
+		if err != nil {
+			return nil, err
+		}
+		turn.Content = append(turn.Content, anthropicResp.Content...)
+		turn.StopReason = anthropicResp.StopReason
+		if anthropicResp.StopReason != "pause_turn" || resumes == maxAnthropicResumes {
+			break
+		}
+		c.logger.Info("Resuming paused Anthropic turn", "model", c.config.ModelName, "resumes", resumes+1)
+		if len(anthropicResp.Content) == 0 {
+			continue
+		}
+		if last := len(request.Messages) - 1; last >= 0 && request.Messages[last].Role == "assistant" {
+			request.Messages[last].Content = append(request.Messages[last].Content, anthropicResp.Content...)
+		} else {
+			request.Messages = append(request.Messages, anthropicMessage{Role: "assistant", Content: anthropicResp.Content})
+		}
+	}
+	response := turn.toChatCompletion(names)
+	response.Model = c.config.ModelName
+	return response, nil
+}
+
+// post sends one Messages API request and reads its response, streamed or not.
+func (c *AnthropicClient) post(ctx context.Context, request *anthropicRequest, onDelta func(string)) (*anthropicResponse, error) {
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request body: %w", err)
+	}
+
+	serverURL := c.config.ServerURL
+	if serverURL == "" {
+		serverURL = DefaultAnthropicURL
+	}
+	version := c.config.Version
+	if version == "" {
+		version = "2023-06-01"
+	}
+	c.logger.Info("Sending Anthropic request", "url", serverURL, "model", c.config.ModelName, "stream", request.Stream)
+	resp, err := doLLMRequest(ctx, c.client, llmRetryPolicy(c.config.Retry), c.logger, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", serverURL, bytes.NewReader(requestBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-api-key", c.config.APIKey)
+		req.Header.Set("anthropic-version", version)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return c.readStream(resp.Body, onDelta)
+	}
+	var anthropicResp anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+		return nil, fmt.Errorf("could not decode response body: %w", err)
+	}
+	if onDelta != nil {
+		for _, block := range anthropicResp.Content {
+			if block.Type == "text" && block.Text != "" {
+				onDelta(block.Text)
+			}
+		}
+	}
+	return &anthropicResp, nil
+}
+
+// readStream assembles a streamed response from its content_block and message_delta events.
+func (c *AnthropicClient) readStream(body io.Reader, onDelta func(string)) (*anthropicResponse, error) {
+	var anthropicResp anthropicResponse
+	blocks := make(map[int]int)              // Stream index -> position in anthropicResp.Content
+	inputs := make(map[int]*strings.Builder) // Stream index -> tool_use input received so far
+
+	reader := bufio.NewReader(body)
+	for {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "data:") {
+			jsonStr := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			var event anthropicStreamEvent
+			if err := json.Unmarshal([]byte(jsonStr), &event); err != nil {
+				c.logger.Warn("Warning: Error unmarshaling Anthropic stream event", "error", err, "data", jsonStr)
+			} else {
+				switch event.Type {
+				case "content_block_start":
+					blocks[event.Index] = len(anthropicResp.Content)
+					block := event.ContentBlock
+					block.Input = nil // Sent empty at the start; streamed as input_json_delta
+					anthropicResp.Content = append(anthropicResp.Content, block)
+					inputs[event.Index] = &strings.Builder{}
+				case "content_block_delta":
+					pos, ok := blocks[event.Index]
+					if !ok {
+						continue
+					}
+					switch event.Delta.Type {
+					case "text_delta":
+						anthropicResp.Content[pos].Text += event.Delta.Text
+						if onDelta != nil && event.Delta.Text != "" {
+							onDelta(event.Delta.Text)
+						}
+					case "input_json_delta":
+						inputs[event.Index].WriteString(event.Delta.PartialJSON)
+					}
+				case "content_block_stop":
+					if pos, ok := blocks[event.Index]; ok && anthropicResp.Content[pos].Type == "tool_use" {
+						anthropicResp.Content[pos].Input = json.RawMessage(inputs[event.Index].String())
+					}
+				case "message_delta":
+					if event.Delta.StopReason != "" {
+						anthropicResp.StopReason = event.Delta.StopReason
+					}
+				case "message_stop":
+					return &anthropicResp, nil
+				case "error":
+					return nil, fmt.Errorf("anthropic stream error: %s: %s", event.Error.Type, event.Error.Message)
+				}
+			}
+		}
+
+		if readErr != nil {
+			if readErr == io.EOF {
+				return &anthropicResp, nil
+			}
+			return nil, fmt.Errorf("error reading stream: %w", readErr)
+		}
+	}
+}
+
+// buildRequest converts the conversation to a Messages API request. System messages are
+// joined into the system prompt; "tool" messages become tool_result blocks in a user turn,
+// and consecutive messages of the same role are merged, as the API requires roles to alternate.
+func (c *AnthropicClient) buildRequest(messages []Message, tools []Tool, toolChoice interface{}, names *anthropicToolNames) (*anthropicRequest, error) {
+	maxTokens := c.config.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 4096
+	}
+	request := &anthropicRequest{Model: c.config.ModelName, MaxTokens: maxTokens}
+
+	var system []string
+	for _, message := range messages {
+		var role string
+		var blocks []anthropicContentBlock
+		switch message.Role {
+		case "system":
+			system = append(system, message.Content)
+			continue
+		case "tool":
+			role = "user"
+			blocks = append(blocks, anthropicContentBlock{Type: "tool_result", ToolUseID: message.ToolCallID, Content: message.Content, IsError: message.toolFailed})
+		case "assistant":
+			role = "assistant"
+			if message.Content != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: message.Content})
+			}
+			for _, toolCall := range message.ToolCalls {
+				input := json.RawMessage(toolCall.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				apiName, err := names.apiName(toolCall.Function.Name)
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, anthropicContentBlock{Type: "tool_use", ID: toolCall.ID, Name: apiName, Input: input})
+			}
+		default:
+			role = "user"
+			if message.Content != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: message.Content})
+			}
+		}
+		if len(blocks) == 0 {
+			continue // The API rejects empty messages
+		}
+
+		if last := len(request.Messages) - 1; last >= 0 && request.Messages[last].Role == role {
+			request.Messages[last].Content = append(request.Messages[last].Content, blocks...)
+		} else {
+			request.Messages = append(request.Messages, anthropicMessage{Role: role, Content: blocks})
+		}
+	}
+	request.System = strings.Join(system, "\n\n")
+
+	for _, tool := range tools {
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object"}
+		}
+		apiName, err := names.apiName(tool.Function.Name)
+		if err != nil {
+			return nil, err
+		}
+		request.Tools = append(request.Tools, anthropicTool{Name: apiName, Description: tool.Function.Description, InputSchema: schema})
+	}
+
+	choice, err := anthropicToolChoice(toolChoice, names)
+	if err != nil {
+		return nil, err
+	}
+	request.ToolChoice = choice
+	return request, nil
+}
+
+// anthropicToolChoice converts an OpenAI tool_choice value to its Messages API equivalent.
+func anthropicToolChoice(toolChoice interface{}, names *anthropicToolNames) (interface{}, error) {
+	switch choice := toolChoice.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		switch choice {
+		case "auto":
+			return map[string]string{"type": "auto"}, nil
+		case "none":
+			return map[string]string{"type": "none"}, nil
+		case "required":
+			return map[string]string{"type": "any"}, nil
+		}
+	default:
+		// {"type": "function", "function": {"name": ...}}, as a map or a struct
+		encoded, err := json.Marshal(choice)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal tool choice: %w", err)
+		}
+		var named struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(encoded, &named); err == nil && named.Function.Name != "" {
+			apiName, err := names.apiName(named.Function.Name)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"type": "tool", "name": apiName}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported tool choice: %v", toolChoice)
+}
+
+// toChatCompletion converts a Messages API response to a ChatCompletionResponse.
+func (r *anthropicResponse) toChatCompletion(names *anthropicToolNames) *ChatCompletionResponse {
+	message := Message{Role: "assistant"}
+	var content strings.Builder
+	for _, block := range r.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "tool_use":
+			arguments := string(block.Input)
+			if strings.TrimSpace(arguments) == "" {
+				arguments = "{}"
+			}
+			message.ToolCalls = append(message.ToolCalls, ToolCall{ID: block.ID, Type: "function", Function: FunctionCall{Name: names.name(block.Name), Arguments: arguments}})
+		}
+	}
+	message.Content = content.String()
+	return &ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: anthropicFinishReason(r.StopReason)}}}
+}
+
+// anthropicFinishReason maps a Messages API stop_reason to an OpenAI finish_reason. Reasons
+// without an equivalent, such as "pause_turn" after too many resumes, are returned as they
+// are, so they are not mistaken for a finished turn.
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	case "refusal":
+		return "content_filter"
+	}
+	return stopReason
+}
@@ -0,0 +1,213 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAnthropicClient(t *testing.T, handler http.HandlerFunc) *AnthropicClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	return NewAnthropicClient(&AnthropicClientConfig{ServerURL: server.URL, APIKey: "test-key", ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+}
+
+func TestAnthropicClientCallChatCompletion(t *testing.T) {
+	client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, "2023-06-01", r.Header.Get("anthropic-version"))
+
+		var req anthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "test-model", req.Model)
+		assert.Equal(t, 4096, req.MaxTokens)
+		assert.Equal(t, "Be helpful.", req.System)
+		require.Len(t, req.Tools, 1)
+		assert.Equal(t, "echo__echo", req.Tools[0].Name)
+		assert.Nil(t, req.ToolChoice)
+
+		// The two tool results are merged into one user turn after the assistant's tool_use blocks.
+		require.Len(t, req.Messages, 3)
+		assert.Equal(t, "user", req.Messages[0].Role)
+		assert.Equal(t, "assistant", req.Messages[1].Role)
+		require.Len(t, req.Messages[1].Content, 3)
+		assert.Equal(t, "text", req.Messages[1].Content[0].Type)
+		assert.Equal(t, "tool_use", req.Messages[1].Content[1].Type)
+		assert.Equal(t, "echo__echo", req.Messages[1].Content[1].Name)
+		assert.JSONEq(t, `{"text": "a"}`, string(req.Messages[1].Content[1].Input))
+		assert.Equal(t, "user", req.Messages[2].Role)
+		require.Len(t, req.Messages[2].Content, 2)
+		assert.Equal(t, anthropicContentBlock{Type: "tool_result", ToolUseID: "call_1", Content: "a"}, req.Messages[2].Content[0])
+		assert.Equal(t, "call_2", req.Messages[2].Content[1].ToolUseID)
+		assert.True(t, req.Messages[2].Content[1].IsError, "a failed call's result should be flagged")
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"content": [
+			{"type": "text", "text": "Echoing again."},
+			{"type": "tool_use", "id": "toolu_1", "name": "echo__echo", "input": {"text": "c"}}
+		], "stop_reason": "tool_use"}`)
+	})
+
+	response, err := client.CallChatCompletion(context.Background(), []Message{
+		{Role: "system", Content: "Be helpful."},
+		{Role: "user", Content: "echo a and b"},
+		{Role: "assistant", Content: "Echoing.", ToolCalls: []ToolCall{
+			{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "a"}`}},
+			{ID: "call_2", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "b"}`}},
+		}},
+		{Role: "tool", Content: "a", ToolCallID: "call_1", Name: "echo.echo"},
+		{Role: "tool", Content: "b failed", ToolCallID: "call_2", Name: "echo.echo", toolFailed: true},
+	}, []Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo", Parameters: json.RawMessage(`{"type": "object"}`)}}})
+	require.NoError(t, err)
+
+	require.Len(t, response.Choices, 1)
+	choice := response.Choices[0]
+	assert.Equal(t, "tool_calls", choice.FinishReason)
+	assert.Equal(t, "Echoing again.", choice.Message.Content)
+	assert.Equal(t, []ToolCall{{ID: "toolu_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "c"}`}}}, choice.Message.ToolCalls)
+}
+
+func TestAnthropicClientStream(t *testing.T) {
+	client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		assert.Equal(t, map[string]interface{}{"type": "any"}, req.ToolChoice)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type": "message_start", "message": {"id": "msg_1"}}`,
+			`{"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}`,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Let me "}}`,
+			`{"type": "ping"}`,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "check."}}`,
+			`{"type": "content_block_stop", "index": 0}`,
+			`{"type": "content_block_start", "index": 1, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "echo__echo", "input": {}}}`,
+			`{"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "{\"text\": "}}`,
+			`{"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "\"hi\"}"}}`,
+			`{"type": "content_block_stop", "index": 1}`,
+			`{"type": "message_delta", "delta": {"stop_reason": "tool_use"}}`,
+			`{"type": "message_stop"}`,
+		} {
+			var typed struct{ Type string }
+			require.NoError(t, json.Unmarshal([]byte(event), &typed))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	})
+
+	var deltas []string
+	response, err := client.StreamChatCompletionWithToolChoice(context.Background(), []Message{{Role: "user", Content: "echo hi"}},
+		[]Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo"}}}, "required", func(delta string) { deltas = append(deltas, delta) })
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Let me ", "check."}, deltas)
+	choice := response.Choices[0]
+	assert.Equal(t, "tool_calls", choice.FinishReason)
+	assert.Equal(t, "Let me check.", choice.Message.Content)
+	assert.Equal(t, []ToolCall{{ID: "toolu_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "hi"}`}}}, choice.Message.ToolCalls)
+}
+
+func TestAnthropicFinishReason(t *testing.T) {
+	for stopReason, want := range map[string]string{
+		"end_turn":      "stop",
+		"stop_sequence": "stop",
+		"tool_use":      "tool_calls",
+		"max_tokens":    "length",
+		"refusal":       "content_filter",
+		"pause_turn":    "pause_turn",
+	} {
+		assert.Equal(t, want, anthropicFinishReason(stopReason), stopReason)
+	}
+}
+
+func TestAnthropicClientResumesPausedTurn(t *testing.T) {
+	requests := 0
+	client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			require.Len(t, req.Messages, 1)
+			fmt.Fprint(w, `{"content": [{"type": "text", "text": "Searching."}], "stop_reason": "pause_turn"}`)
+			return
+		}
+		// The paused content is sent back as the start of the assistant turn.
+		require.Len(t, req.Messages, 2)
+		assert.Equal(t, anthropicMessage{Role: "assistant", Content: []anthropicContentBlock{{Type: "text", Text: "Searching."}}}, req.Messages[1])
+		fmt.Fprint(w, `{"content": [{"type": "text", "text": " Found it."}], "stop_reason": "end_turn"}`)
+	})
+
+	response, err := client.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "search"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, "stop", response.Choices[0].FinishReason)
+	assert.Equal(t, "Searching. Found it.", response.Choices[0].Message.Content)
+}
+
+func TestAnthropicToolNames(t *testing.T) {
+	names := newAnthropicToolNames()
+	prefix := "agent." + strings.Repeat("x", 70)
+	first, err := names.apiName(prefix + "_first")
+	require.NoError(t, err)
+	second, err := names.apiName(prefix + "_second")
+	require.NoError(t, err)
+	assert.Len(t, first, anthropicMaxToolNameLength)
+	assert.Len(t, second, anthropicMaxToolNameLength)
+	assert.NotEqual(t, first, second, "long names sharing a prefix should stay distinct")
+	assert.Equal(t, prefix+"_first", names.name(first))
+	assert.Equal(t, prefix+"_second", names.name(second))
+
+	again, err := names.apiName(prefix + "_first")
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	_, err = names.apiName("echo.a b")
+	require.NoError(t, err)
+	_, err = names.apiName("echo.a_b")
+	assert.ErrorContains(t, err, "both map to the Anthropic tool name")
+}
+
+func TestAgentWithAnthropicProvider(t *testing.T) {
+	var requests []anthropicRequest
+	client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"content": [{"type": "tool_use", "id": "toolu_1", "name": "echo__echo", "input": {"text": "hi"}}], "stop_reason": "tool_use"}`)
+			return
+		}
+		fmt.Fprint(w, `{"content": [{"type": "text", "text": "It said hi."}], "stop_reason": "end_turn"}`)
+	})
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	echoClient, err := NewMCPClientWithConfig(&MCPConfig{Alias: "echo", Transport: MCPTransportInProcess, Server: newEchoMCPServer()}, logger)
+	require.NoError(t, err)
+	defer echoClient.Close()
+	availableTools := []Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo", Parameters: json.RawMessage(`{"type": "object"}`)}}}
+	agent := NewAgent(client, map[string]*MCPClient{"echo": echoClient}, logger, availableTools)
+	agent.SetStrategy(ReActStrategy{})
+
+	finalResult, err := agent.Execute(context.Background(), "echo hi")
+	require.NoError(t, err)
+	assert.Equal(t, "It said hi.", finalResult)
+
+	require.Len(t, requests, 2)
+	last := requests[1].Messages[len(requests[1].Messages)-1]
+	assert.Equal(t, "user", last.Role)
+	assert.Equal(t, []anthropicContentBlock{{Type: "tool_result", ToolUseID: "toolu_1", Content: "hi"}}, last.Content)
+}
@@ -2,13 +2,62 @@ package go_as
 
 // OrchestrationRequest represents a request to the Orchestrator.
 type OrchestrationRequest struct {
-	Query string
+	Query string `json:"query"`
+	// Strategy names the AgentStrategy to run the task with, e.g. "react". Empty uses the
+	// orchestrator's default.
+	Strategy string `json:"strategy"`
+	// DryRun plans the task and validates the tool calls it would make without running them.
+	// The result update then carries a DryRunReport.
+	DryRun bool `json:"dry_run"`
 	// Add other request fields here
 }
 
+// Update types emitted on the ExecuteTask update channel.
+const (
+	// UpdateTypePlan carries the plan produced by the planning phase, or a revised plan.
+	UpdateTypePlan = "plan"
+	// UpdateTypeStepStarted is sent when the agent starts working on a plan step.
+	UpdateTypeStepStarted = "step_started"
+	// UpdateTypeStepSkipped is sent when a step of a structured plan is skipped because a
+	// step it depends on did not succeed; Content gives the reason.
+	UpdateTypeStepSkipped = "step_skipped"
+	// UpdateTypeToolCall is sent before a tool is invoked, with its arguments.
+	UpdateTypeToolCall = "tool_call"
+	// UpdateTypeApprovalRequired is sent when a tool call is paused until a human approves or
+	// rejects it; ApprovalID identifies it for the decision.
+	UpdateTypeApprovalRequired = "approval_required"
+	// UpdateTypeToolResult carries the synthesized result (or error) of a tool call.
+	UpdateTypeToolResult = "tool_result"
+	// UpdateTypeToken carries a content fragment streamed by the LLM.
+	UpdateTypeToken = "token"
+	// UpdateTypeResult carries the final answer and is the last update of a successful task.
+	UpdateTypeResult = "result"
+	// UpdateTypeError is the last update of a failed task.
+	UpdateTypeError = "error"
+)
+
 // OrchestrationUpdate represents an update or result from the Orchestrator.
 type OrchestrationUpdate struct {
 	Type    string `json:"type"`
 	Content string `json:"content"`
-	Error   error  `json:"error,omitempty"`
+	Error   error  `json:"-"`
+	// ErrorMessage is Error's message, filled in when the update is sent, since an error
+	// value has no JSON form of its own.
+	ErrorMessage string `json:"error_message,omitempty"`
+
+	Plan        []string `json:"plan,omitempty"`         // Set on plan updates
+	PlanVersion int      `json:"plan_version,omitempty"` // Set on plan updates; versions after 1 are revised plans
+	Step        int      `json:"step,omitempty"`         // 1-based plan step for step_started, tool_call and tool_result
+	Tool        string   `json:"tool,omitempty"`         // Full "alias.tool" name for tool_call, approval_required and tool_result
+	Arguments   string   `json:"arguments,omitempty"`    // JSON arguments for tool_call and approval_required
+	ApprovalID  string   `json:"approval_id,omitempty"`  // Set on approval_required updates
+	// Model that produced the plan, tool call or answer, as named in the LLM configuration. Set
+	// on plan, tool_call, approval_required, tool_result and result updates; with an
+	// LLMFallback it can change from one step to the next.
+	Model string `json:"model,omitempty"`
+
+	DryRun *DryRunReport `json:"dry_run,omitempty"` // Set on the result of a dry run
+	// Record of the run, with every plan version and why it was revised. Set on the result
+	// update, and on the error update of a task that failed after the agent started.
+	Record *RunRecord `json:"record,omitempty"`
 }
@@ -0,0 +1,174 @@
+package go_as
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ApprovalPolicy selects the tool calls that need a human decision before they run.
+type ApprovalPolicy struct {
+	// Tools lists "alias.tool" patterns that require approval, e.g. "fs.delete_item" for one
+	// tool, "fs.*" for every tool of an agent or "*.write_file" for a tool on any agent.
+	Tools []string
+	// Timeout is how long a paused run waits for a decision before the call is rejected.
+	// Zero uses DefaultApprovalTimeout.
+	Timeout time.Duration
+}
+
+// DefaultApprovalTimeout is used when ApprovalPolicy.Timeout is zero.
+const DefaultApprovalTimeout = 5 * time.Minute
+
+// ApprovalDecision is a human's answer to an approval_required update.
+type ApprovalDecision struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PendingApproval is a tool call waiting for a decision.
+type PendingApproval struct {
+	ID          string    `json:"id"`
+	Tool        string    `json:"tool"`
+	Arguments   string    `json:"arguments"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// ApprovalManager pauses tool calls that its policy selects until a decision arrives
+// through Decide, or the policy's timeout passes.
+type ApprovalManager struct {
+	policy ApprovalPolicy
+
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+type pendingApproval struct {
+	PendingApproval
+	decision chan ApprovalDecision // Buffered; receives at most one decision
+}
+
+// NewApprovalManager creates an ApprovalManager enforcing policy.
+func NewApprovalManager(policy ApprovalPolicy) *ApprovalManager {
+	return &ApprovalManager{
+		policy:  policy,
+		pending: make(map[string]*pendingApproval),
+	}
+}
+
+// Requires reports whether calls to toolName ("alias.tool") need approval.
+func (m *ApprovalManager) Requires(toolName string) bool {
+	for _, pattern := range m.policy.Tools {
+		if matched, err := path.Match(pattern, toolName); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Decide delivers a decision for the pending approval id.
+func (m *ApprovalManager) Decide(id string, decision ApprovalDecision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending, ok := m.pending[id]
+	if !ok {
+		return fmt.Errorf("no pending approval %s", id)
+	}
+	delete(m.pending, id) // Later decisions for the same approval are rejected
+	pending.decision <- decision
+	return nil
+}
+
+// Pending returns the tool calls waiting for a decision, oldest first.
+func (m *ApprovalManager) Pending() []PendingApproval {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	approvals := make([]PendingApproval, 0, len(m.pending))
+	for _, pending := range m.pending {
+		approvals = append(approvals, pending.PendingApproval)
+	}
+	sort.Slice(approvals, func(i, j int) bool { return approvals[i].RequestedAt.Before(approvals[j].RequestedAt) })
+	return approvals
+}
+
+// request registers a pending approval for toolCall. The caller must call wait.
+func (m *ApprovalManager) request(toolCall *ToolCall) (*pendingApproval, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate approval id: %w", err)
+	}
+	pending := &pendingApproval{
+		PendingApproval: PendingApproval{
+			ID:          hex.EncodeToString(idBytes),
+			Tool:        toolCall.Function.Name,
+			Arguments:   toolCall.Function.Arguments,
+			RequestedAt: time.Now(),
+		},
+		decision: make(chan ApprovalDecision, 1),
+	}
+	m.mu.Lock()
+	m.pending[pending.ID] = pending
+	m.mu.Unlock()
+	return pending, nil
+}
+
+// wait blocks until pending is decided, the policy's timeout passes or ctx is done.
+// A timeout is returned as an error, like a cancelled ctx.
+func (m *ApprovalManager) wait(ctx context.Context, pending *pendingApproval) (ApprovalDecision, error) {
+	timeout := m.policy.Timeout
+	if timeout == 0 {
+		timeout = DefaultApprovalTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case decision := <-pending.decision:
+		return decision, nil
+	case <-timer.C:
+		err = fmt.Errorf("no decision within %s", timeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pending[pending.ID]; !ok {
+		// Decide won the race and its decision is already buffered.
+		return <-pending.decision, nil
+	}
+	delete(m.pending, pending.ID)
+	return ApprovalDecision{}, err
+}
+
+// awaitApproval pauses a tool call that needs approval: it reports an approval_required
+// update and waits for the decision. It returns an error if the call must not run.
+func (a *Agent) awaitApproval(ctx context.Context, step int, toolCall *ToolCall) error {
+	if a.updateChan == nil {
+		return fmt.Errorf("tool %s requires approval, but no one is listening for approval requests", toolCall.Function.Name)
+	}
+	pending, err := a.approvals.request(toolCall)
+	if err != nil {
+		return err
+	}
+
+	a.logger.Info("Agent: Waiting for approval.", "tool", toolCall.Function.Name, "approval_id", pending.ID)
+	a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeApprovalRequired, Step: step, Tool: toolCall.Function.Name, Arguments: toolCall.Function.Arguments, ApprovalID: pending.ID})
+	decision, err := a.approvals.wait(ctx, pending)
+	if err != nil {
+		return fmt.Errorf("tool call was not approved: %w", err)
+	}
+	if !decision.Approved {
+		if decision.Reason != "" {
+			return fmt.Errorf("tool call was rejected: %s", decision.Reason)
+		}
+		return fmt.Errorf("tool call was rejected")
+	}
+	a.logger.Info("Agent: Tool call approved.", "tool", toolCall.Function.Name, "approval_id", pending.ID)
+	return nil
+}
@@ -0,0 +1,115 @@
+package go_as
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApprovalManagerRequires(t *testing.T) {
+	manager := NewApprovalManager(ApprovalPolicy{Tools: []string{"fs.delete_item", "shell.*", "*.write_file"}})
+
+	tests := []struct {
+		tool string
+		want bool
+	}{
+		{"fs.delete_item", true},
+		{"fs.read_file", false},
+		{"shell.run", true},
+		{"fs.write_file", true},
+		{"notes.write_file", true},
+		{"echo.echo", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, manager.Requires(tt.tool), tt.tool)
+	}
+}
+
+func TestAgentWaitsForApproval(t *testing.T) {
+	tests := []struct {
+		name        string
+		decision    *ApprovalDecision // nil lets the approval time out
+		wantRun     bool
+		wantContent string
+	}{
+		{name: "approved", decision: &ApprovalDecision{Approved: true}, wantRun: true, wantContent: "secret"},
+		{name: "rejected", decision: &ApprovalDecision{Approved: false, Reason: "not today"}, wantContent: "tool call was rejected: not today"},
+		{name: "timed out", wantContent: "no decision within 100ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests [][]Message
+			agent := newStrategyTestAgent(t, []Message{
+				{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "secret"}`}}}},
+				{Role: "assistant", Content: "Final answer"},
+			}, &requests)
+			agent.SetStrategy(ReActStrategy{})
+			manager := NewApprovalManager(ApprovalPolicy{Tools: []string{"echo.*"}, Timeout: 100 * time.Millisecond})
+			agent.SetApprovals(manager)
+
+			updates := make(chan OrchestrationUpdate)
+			agent.SetUpdateChannel(updates)
+			var got []OrchestrationUpdate
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for update := range updates {
+					got = append(got, update)
+					if update.Type == UpdateTypeApprovalRequired {
+						pending := manager.Pending()
+						require.Len(t, pending, 1)
+						assert.Equal(t, update.ApprovalID, pending[0].ID)
+						assert.Equal(t, `{"text": "secret"}`, pending[0].Arguments)
+						if tt.decision != nil {
+							require.NoError(t, manager.Decide(update.ApprovalID, *tt.decision))
+							assert.Error(t, manager.Decide(update.ApprovalID, *tt.decision), "a second decision must be rejected")
+						}
+					}
+				}
+			}()
+
+			finalResult, err := agent.Execute(context.Background(), "echo a secret")
+			close(updates)
+			<-done
+			require.NoError(t, err)
+			assert.Equal(t, "Final answer", finalResult)
+			assert.Empty(t, manager.Pending())
+
+			var approval, result *OrchestrationUpdate
+			for i := range got {
+				switch got[i].Type {
+				case UpdateTypeApprovalRequired:
+					approval = &got[i]
+				case UpdateTypeToolResult:
+					result = &got[i]
+				}
+			}
+			require.NotNil(t, approval)
+			assert.Equal(t, "echo.echo", approval.Tool)
+			require.NotNil(t, result)
+			assert.Equal(t, !tt.wantRun, result.Error != nil)
+
+			history := requests[1]
+			assert.Contains(t, history[len(history)-1].Content, tt.wantContent)
+		})
+	}
+}
+
+func TestAgentWithoutUpdateChannelRejectsApprovals(t *testing.T) {
+	var requests [][]Message
+	agent := newStrategyTestAgent(t, []Message{
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "hi"}`}}}},
+		{Role: "assistant", Content: "Final answer"},
+	}, &requests)
+	agent.SetStrategy(ReActStrategy{})
+	agent.SetApprovals(NewApprovalManager(ApprovalPolicy{Tools: []string{"echo.echo"}}))
+
+	_, err := agent.Execute(context.Background(), "echo hi")
+	require.NoError(t, err)
+	history := requests[1]
+	assert.Contains(t, history[len(history)-1].Content, "no one is listening for approval requests")
+}
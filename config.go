@@ -1,13 +1,163 @@
 package go_as
 
+import (
+	"time"
+
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
 // OrchestratorConfig holds configuration for the Orchestrator.
 type OrchestratorConfig struct {
-	// Add configuration fields here
+	// LLM is the chat model backend. A nil value creates one from the environment with
+	// NewLLMProviderFromEnv.
+	LLM LLMProvider
+	// Budget limits the work done by each task. A nil value uses DefaultAgentBudget.
+	Budget *AgentBudget
+	// DefaultStrategy names the AgentStrategy used for requests that don't select one.
+	// An empty value uses StrategyPlanExecute.
+	DefaultStrategy string
+	// Approvals selects tool calls that wait for a human decision before they run.
+	// A nil value lets every tool call run immediately.
+	Approvals *ApprovalPolicy
+}
+
+// AgentBudget limits how much work a single agent run may do. A zero field disables that limit.
+type AgentBudget struct {
+	// MaxSteps is the number of times the execution phase may ask the LLM for the next action.
+	MaxSteps int
+	// MaxToolCalls is the total number of tool calls the run may make.
+	MaxToolCalls int
+	// MaxDuration bounds the wall-clock time of the whole run, planning included.
+	MaxDuration time.Duration
+	// MaxRepeatedToolCalls is how many times the same tool may be called with the same
+	// arguments before the run is considered stuck in a loop.
+	MaxRepeatedToolCalls int
+	// MaxReplans is how many times the plan may be revised after failing steps or at Nexus's request.
+	MaxReplans int
 }
 
+// DefaultAgentBudget returns the budget used when OrchestratorConfig.Budget is nil.
+func DefaultAgentBudget() AgentBudget {
+	return AgentBudget{
+		MaxSteps:             20,
+		MaxToolCalls:         50,
+		MaxDuration:          10 * time.Minute,
+		MaxRepeatedToolCalls: 3,
+		MaxReplans:           3,
+	}
+}
+
+// MCPTransport identifies how the orchestrator talks to an MCP agent.
+type MCPTransport string
+
+const (
+	// MCPTransportStdio launches Command as a local subprocess and speaks MCP over stdin/stdout.
+	MCPTransportStdio MCPTransport = "stdio"
+	// MCPTransportSSE connects to a remote MCP server using the HTTP+SSE transport.
+	MCPTransportSSE MCPTransport = "sse"
+	// MCPTransportStreamableHTTP connects to a remote MCP server using the streamable HTTP transport.
+	MCPTransportStreamableHTTP MCPTransport = "streamable_http"
+	// MCPTransportInProcess dispatches calls directly to an mcp-go server living in this process.
+	MCPTransportInProcess MCPTransport = "inprocess"
+)
+
 // MCPConfig holds configuration for a Managed Compute Provider (MCP).
 type MCPConfig struct {
-	Alias   string
+	Alias string
+	// Transport selects the connection kind. An empty value is treated as MCPTransportStdio.
+	Transport MCPTransport
+
+	// Command, Args and Env are used by the stdio transport.
 	Command string
 	Args    []string
+	Env     []string
+
+	// URL and Headers are used by the SSE and streamable HTTP transports.
+	URL     string
+	Headers map[string]string
+
+	// Server is used by the in-process transport.
+	Server *mcpserver.MCPServer
+
+	// Restart configures supervision of stdio agents. A nil value uses DefaultRestartPolicy.
+	Restart *RestartPolicy
+}
+
+// RestartPolicy controls how a crashed stdio MCP agent is restarted.
+type RestartPolicy struct {
+	// Disabled turns off supervision entirely.
+	Disabled bool
+	// MaxAttempts is the number of consecutive restart attempts before the agent is marked failed.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first restart attempt; it doubles on every failure.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between restart attempts.
+	MaxBackoff time.Duration
+	// HealthCheckInterval is how often the agent is pinged to detect a dead transport.
+	HealthCheckInterval time.Duration
+}
+
+// DefaultRestartPolicy returns the restart policy used when MCPConfig.Restart is nil. Zero
+// fields of a configured policy take their values from it.
+func DefaultRestartPolicy() RestartPolicy {
+	return RestartPolicy{
+		MaxAttempts:         5,
+		InitialBackoff:      500 * time.Millisecond,
+		MaxBackoff:          30 * time.Second,
+		HealthCheckInterval: 10 * time.Second,
+	}
+}
+
+// LLMRetryPolicy controls how LLM requests that fail with a transient error are retried.
+type LLMRetryPolicy struct {
+	// MaxAttempts is the number of attempts per request, the first included. 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; it grows by Multiplier on every retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff delay between attempts. It does not shorten a Retry-After,
+	// since an earlier attempt would be refused anyway.
+	MaxBackoff time.Duration
+	// MaxRetryAfter, if set, ends the retries when a Retry-After asks for a longer wait.
+	// Zero waits as long as asked, as far as the context's deadline allows.
+	MaxRetryAfter time.Duration
+	// Multiplier is the factor the delay grows by. Zero uses 2.
+	Multiplier float64
+	// Jitter randomizes every delay by up to this fraction of it (0.2 means ±20%), so that
+	// clients that failed together don't retry together.
+	Jitter float64
+	// RetryableStatusCodes are the HTTP statuses worth retrying. nil uses DefaultRetryableStatusCodes.
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryableStatusCodes are the HTTP statuses LLM requests are retried on by default:
+// timeouts, rate limits, server errors and overloaded servers.
+var DefaultRetryableStatusCodes = []int{408, 425, 429, 500, 502, 503, 504, 529}
+
+// DefaultLLMRetryPolicy returns the retry policy used when an LLM client's Retry is nil.
+func DefaultLLMRetryPolicy() LLMRetryPolicy {
+	return LLMRetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// CircuitBreakerPolicy controls when a provider of an LLMFallback that keeps failing is taken out of rotation.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failed requests, each after its retries,
+	// that opens the provider's circuit.
+	FailureThreshold int
+	// Cooldown is how long an open circuit skips the provider. After it, a single trial request
+	// is sent to the provider: success closes the circuit, failure opens it again.
+	Cooldown time.Duration
+}
+
+// DefaultCircuitBreakerPolicy returns the policy used when NewLLMFallback is given a nil policy.
+func DefaultCircuitBreakerPolicy() CircuitBreakerPolicy {
+	return CircuitBreakerPolicy{
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+	}
 }
@@ -0,0 +1,101 @@
+package go_as
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errDryRunStopped stops a dry run of a structured plan once its tool steps are recorded.
+var errDryRunStopped = errors.New("dry run stopped before calling tools")
+
+// DryRunReport describes what a task would do without doing it: the plan and the tool calls
+// the agent decided on, each with the result of validating its arguments.
+type DryRunReport struct {
+	Plan      []string          `json:"plan,omitempty"`
+	ToolCalls []PlannedToolCall `json:"tool_calls"`
+	Note      string            `json:"note,omitempty"` // Set if the run decided on no tool calls at all
+}
+
+// PlannedToolCall is a tool call a dry run would have made.
+type PlannedToolCall struct {
+	Step      int      `json:"step,omitempty"` // 1-based plan step the call belongs to
+	Tool      string   `json:"tool"`
+	Arguments string   `json:"arguments"`
+	Valid     bool     `json:"valid"`            // Whether the arguments match the tool's input schema
+	Errors    []string `json:"errors,omitempty"` // Why the arguments do not match
+}
+
+// SetDryRun makes Execute plan the task without running any tools. Each tool call the agent
+// decides on is validated against its tool's input schema and kept in Record().DryRun; the
+// agent is told the call was skipped and carries on with the next step of its plan, so the
+// calls of every step are collected. Execute then answers with a summary of the report.
+func (a *Agent) SetDryRun(dryRun bool) {
+	a.dryRun = dryRun
+}
+
+// skipToolCalls records toolCalls for a dry run and answers each with a "tool" message
+// saying it was not called, so that the run continues with the rest of the plan.
+func (a *Agent) skipToolCalls(ctx context.Context, toolCalls []ToolCall) {
+	a.recordDryRun(ctx, toolCalls, nil, false)
+	for _, toolCall := range toolCalls {
+		content := fmt.Sprintf("Dry run: %s was not called. Assume it succeeded and continue with the plan.", toolCall.Function.Name)
+		a.history = append(a.history, Message{Role: "tool", Content: content, ToolCallID: toolCall.ID, Name: toolCall.Function.Name})
+	}
+}
+
+// recordDryRun adds toolCalls to the dry run report. In a structured plan, steps holds each
+// call's step; otherwise every call is for the current step.
+func (a *Agent) recordDryRun(ctx context.Context, toolCalls []ToolCall, steps []int, allowTemplates bool) {
+	report := a.record.DryRun
+	for i := range toolCalls {
+		toolCall := &toolCalls[i]
+		step := a.currentStepIdx + 1
+		if steps != nil {
+			step = steps[i]
+		}
+		a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeToolCall, Step: step, Tool: toolCall.Function.Name, Arguments: toolCall.Function.Arguments})
+
+		errs := a.validateToolCall(toolCall, allowTemplates)
+		report.ToolCalls = append(report.ToolCalls, PlannedToolCall{Step: step, Tool: toolCall.Function.Name, Arguments: toolCall.Function.Arguments, Valid: len(errs) == 0, Errors: errs})
+	}
+	a.logger.Info("Agent: Dry run recorded tool calls.", "tool_calls", len(toolCalls))
+}
+
+// finishDryRun completes the dry run report once the run is over and returns its summary.
+func (a *Agent) finishDryRun() string {
+	report := a.record.DryRun
+	report.Plan = a.currentPlan
+	if len(report.ToolCalls) == 0 {
+		report.Note = "The agent decided on no tool calls; the task would be answered without using any tools."
+	}
+	return report.summary()
+}
+
+// summary describes the report for the final answer of a dry run.
+func (r *DryRunReport) summary() string {
+	var builder strings.Builder
+	builder.WriteString("Dry run: no tools were called.\n")
+	if len(r.Plan) > 0 {
+		builder.WriteString("\nPlan:\n")
+		for i, step := range r.Plan {
+			builder.WriteString(fmt.Sprintf("%d. %s\n", i+1, step))
+		}
+	}
+	builder.WriteString("\nTool calls:\n")
+	if len(r.ToolCalls) == 0 {
+		builder.WriteString("(none)\n")
+	}
+	if r.Note != "" {
+		builder.WriteString("\n" + r.Note + "\n")
+	}
+	for _, toolCall := range r.ToolCalls {
+		status := "valid"
+		if !toolCall.Valid {
+			status = "invalid: " + strings.Join(toolCall.Errors, "; ")
+		}
+		builder.WriteString(fmt.Sprintf("- step %d: %s %s (%s)\n", toolCall.Step, toolCall.Tool, toolCall.Arguments, status))
+	}
+	return builder.String()
+}
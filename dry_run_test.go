@@ -0,0 +1,102 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteTaskDryRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []Message // Served in order; later calls get a final answer
+		want      []PlannedToolCall
+		wantNote  bool
+	}{
+		{
+			name: "numbered plan",
+			responses: []Message{
+				{Role: "assistant", Content: "<plan>\n1. Echo twice.\n2. Echo again.\n3. Answer.\n</plan>", ToolCalls: []ToolCall{
+					{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "hi"}`}},
+					{ID: "call_2", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"txt": "hi"}`}},
+				}},
+				{Role: "assistant", ToolCalls: []ToolCall{
+					{ID: "call_3", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "again"}`}},
+				}},
+			},
+			want: []PlannedToolCall{
+				{Step: 1, Tool: "echo.echo", Arguments: `{"text": "hi"}`, Valid: true},
+				{Step: 1, Tool: "echo.echo", Arguments: `{"txt": "hi"}`, Errors: []string{`$: missing required property "text"`}},
+				{Step: 2, Tool: "echo.echo", Arguments: `{"text": "again"}`, Valid: true},
+			},
+		},
+		{
+			name: "no tool calls",
+			responses: []Message{
+				{Role: "assistant", Content: "<plan>\n1. Answer.\n</plan>\nHi."},
+			},
+			wantNote: true,
+		},
+		{
+			name: "structured plan",
+			responses: []Message{{Role: "assistant", Content: `<plan>{"steps": [
+				{"id": "first", "description": "Echo.", "tool": "echo.echo", "arguments": {"text": "hi"}},
+				{"id": "second", "description": "Echo the first output.", "tool": "echo.echo", "arguments": {"text": "{{steps.first.output}}"}},
+				{"id": "missing", "description": "Call a missing tool.", "tool": "echo.missing"},
+				{"id": "answer", "description": "Answer.", "depends_on": ["second"]}
+			]}</plan>`}},
+			want: []PlannedToolCall{
+				{Step: 1, Tool: "echo.echo", Arguments: `{"text": "hi"}`, Valid: true},
+				{Step: 2, Tool: "echo.echo", Arguments: `{"text": "{{steps.first.output}}"}`, Valid: true},
+				{Step: 3, Tool: "echo.missing", Arguments: "{}", Errors: []string{`unknown tool "echo.missing"`}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			calls := 0
+			orchestrator := newTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+				var req ChatCompletionRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				for _, message := range req.Messages {
+					if message.Role == "tool" {
+						assert.True(t, strings.HasPrefix(message.Content, "Dry run: echo.echo was not called."), message.Content)
+					}
+				}
+				mu.Lock()
+				message := Message{Role: "assistant", Content: "Done."}
+				if calls < len(tt.responses) {
+					message = tt.responses[calls]
+				}
+				calls++
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+			})
+
+			updates := make(chan OrchestrationUpdate, 100)
+			go orchestrator.ExecuteTask(context.Background(), &OrchestrationRequest{Query: "echo hi", DryRun: true}, updates)
+			var collected []OrchestrationUpdate
+			for update := range updates {
+				assert.NotEqual(t, UpdateTypeToolResult, update.Type, "a dry run must not call tools")
+				collected = append(collected, update)
+			}
+
+			last := collected[len(collected)-1]
+			require.Equal(t, UpdateTypeResult, last.Type, last.Content)
+			require.NotNil(t, last.DryRun)
+			assert.Equal(t, tt.want, last.DryRun.ToolCalls)
+			assert.NotEmpty(t, last.DryRun.Plan)
+			assert.True(t, strings.HasPrefix(last.Content, "Dry run: no tools were called."))
+			assert.Equal(t, tt.wantNote, last.DryRun.Note != "", last.DryRun.Note)
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package go_as
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultGeminiURL is the base URL of the Gemini API.
+const DefaultGeminiURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// GeminiClientConfig holds configuration for the Gemini client.
+type GeminiClientConfig struct {
+	BaseURL   string // API base URL, without /models/...; empty uses DefaultGeminiURL
+	APIKey    string
+	ModelName string // e.g. "gemini-2.5-flash"
+	Timeout   time.Duration
+	Retry     *LLMRetryPolicy // Retries of failed requests; nil uses DefaultLLMRetryPolicy
+}
+
+// GeminiClient is an LLMProvider for the Gemini generateContent API. Tools are sent as
+// functionDeclarations, and tool calls and results as functionCall and functionResponse parts.
+type GeminiClient struct {
+	config *GeminiClientConfig
+	logger *slog.Logger
+	client *http.Client
+}
+
+// NewGeminiClient creates a new GeminiClient.
+func NewGeminiClient(config *GeminiClientConfig, logger *slog.Logger) *GeminiClient {
+	return &GeminiClient{
+		config: config,
+		logger: logger,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// geminiRequest is the request body of generateContent.
+type geminiRequest struct {
+	SystemInstruction *geminiContent    `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent   `json:"contents"`
+	Tools             []geminiTool      `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig `json:"toolConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart holds one of text, a functionCall or a functionResponse. Thinking models add
+// a thoughtSignature to function calls, which is echoed back with them.
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parametersJsonSchema,omitempty"` // Full JSON Schema, unlike the OpenAPI subset of "parameters"
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
+}
+
+// geminiResponse is the response body of generateContent, or one event of a streamed response.
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+}
+
+// CallChatCompletion sends a generateContent request and converts the response.
+func (c *GeminiClient) CallChatCompletion(ctx context.Context, messages []Message, tools []Tool) (*ChatCompletionResponse, error) {
+	return c.send(ctx, messages, tools, nil, false, nil)
+}
+
+// StreamChatCompletionWithToolChoice sends a streamGenerateContent request and assembles the
+// streamed parts into a ChatCompletionResponse. onDelta is called with every text fragment as
+// it arrives.
+func (c *GeminiClient) StreamChatCompletionWithToolChoice(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, onDelta func(string)) (*ChatCompletionResponse, error) {
+	return c.send(ctx, messages, tools, toolChoice, true, onDelta)
+}
+
+func (c *GeminiClient) send(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, stream bool, onDelta func(string)) (*ChatCompletionResponse, error) {
+	request, err := buildGeminiRequest(messages, tools, toolChoice)
+	if err != nil {
+		return nil, err
+	}
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request body: %w", err)
+	}
+
+	baseURL := c.config.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultGeminiURL
+	}
+	url := fmt.Sprintf("%s/models/%s:generateContent", strings.TrimSuffix(baseURL, "/"), c.config.ModelName)
+	if stream {
+		url = fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", strings.TrimSuffix(baseURL, "/"), c.config.ModelName)
+	}
+	c.logger.Info("Sending Gemini request", "model", c.config.ModelName, "stream", stream)
+	resp, err := doLLMRequest(ctx, c.client, llmRetryPolicy(c.config.Retry), c.logger, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(requestBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-goog-api-key", c.config.APIKey)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	assembled := &geminiAssembler{model: c.config.ModelName, onDelta: onDelta}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var geminiResp geminiResponse
+		if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
+			return nil, fmt.Errorf("could not decode response body: %w", err)
+		}
+		assembled.add(&geminiResp)
+		return assembled.response()
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "data:") {
+			jsonStr := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			var geminiResp geminiResponse
+			if err := json.Unmarshal([]byte(jsonStr), &geminiResp); err != nil {
+				c.logger.Warn("Warning: Error unmarshaling Gemini stream event", "error", err, "data", jsonStr)
+			} else {
+				assembled.add(&geminiResp)
+			}
+		}
+
+		if readErr != nil {
+			if readErr == io.EOF {
+				return assembled.response()
+			}
+			return nil, fmt.Errorf("error reading stream: %w", readErr)
+		}
+	}
+}
+
+// geminiAssembler collects the parts of one or more generateContent responses.
+type geminiAssembler struct {
+	model        string
+	onDelta      func(string)
+	content      strings.Builder
+	toolCalls    []ToolCall
+	finishReason string
+	blockReason  string
+	candidates   int
+}
+
+func (a *geminiAssembler) add(resp *geminiResponse) {
+	if resp.PromptFeedback.BlockReason != "" {
+		a.blockReason = resp.PromptFeedback.BlockReason
+	}
+	if len(resp.Candidates) == 0 {
+		return
+	}
+	a.candidates++
+	candidate := resp.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		if part.Text != "" {
+			a.content.WriteString(part.Text)
+			if a.onDelta != nil {
+				a.onDelta(part.Text)
+			}
+		}
+		if call := part.FunctionCall; call != nil {
+			arguments := string(call.Args)
+			if strings.TrimSpace(arguments) == "" || arguments == "null" {
+				arguments = "{}"
+			}
+			a.toolCalls = append(a.toolCalls, ToolCall{ID: call.ID, Type: "function", Function: FunctionCall{Name: call.Name, Arguments: arguments}, thoughtSignature: part.ThoughtSignature})
+		}
+	}
+	if candidate.FinishReason != "" {
+		a.finishReason = candidate.FinishReason
+	}
+}
+
+func (a *geminiAssembler) response() (*ChatCompletionResponse, error) {
+	if a.candidates == 0 {
+		if a.blockReason != "" {
+			return nil, fmt.Errorf("gemini blocked the prompt: %s", a.blockReason)
+		}
+		return nil, fmt.Errorf("no candidates in LLM response")
+	}
+	return &ChatCompletionResponse{
+		Choices: []ChatCompletionChoice{{
+			Message:      Message{Role: "assistant", Content: a.content.String(), ToolCalls: a.toolCalls},
+			FinishReason: geminiFinishReason(a.finishReason, len(a.toolCalls) > 0),
+		}},
+		Model: a.model,
+	}, nil
+}
+
+// buildGeminiRequest converts the conversation to a generateContent request. System messages
+// become the system instruction, assistant messages "model" turns, and "tool" messages
+// functionResponse parts. Consecutive messages of the same role are merged into one turn, so
+// that all the responses to a turn's function calls are sent together, as the API requires.
+// Gemini matches responses to calls by name and order; the IDs the agent gives calls are
+// not sent, since the API would not recognize them. The thought signature received with a
+// call is sent back with it, as thinking models require.
+func buildGeminiRequest(messages []Message, tools []Tool, toolChoice interface{}) (*geminiRequest, error) {
+	request := &geminiRequest{}
+	var system []geminiPart
+	for _, message := range messages {
+		var role string
+		var parts []geminiPart
+		switch message.Role {
+		case "system":
+			system = append(system, geminiPart{Text: message.Content})
+			continue
+		case "tool":
+			role = "user"
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+				Name:     message.Name,
+				Response: map[string]interface{}{"content": message.Content},
+			}})
+		case "assistant":
+			role = "model"
+			if message.Content != "" {
+				parts = append(parts, geminiPart{Text: message.Content})
+			}
+			for _, toolCall := range message.ToolCalls {
+				args := json.RawMessage(toolCall.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: toolCall.Function.Name, Args: args}, ThoughtSignature: toolCall.thoughtSignature})
+			}
+		default:
+			role = "user"
+			if message.Content != "" {
+				parts = append(parts, geminiPart{Text: message.Content})
+			}
+		}
+		if len(parts) == 0 {
+			continue // The API rejects turns without parts
+		}
+
+		if last := len(request.Contents) - 1; last >= 0 && request.Contents[last].Role == role {
+			request.Contents[last].Parts = append(request.Contents[last].Parts, parts...)
+		} else {
+			request.Contents = append(request.Contents, geminiContent{Role: role, Parts: parts})
+		}
+	}
+	if len(system) > 0 {
+		request.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(tools) > 0 {
+		declarations := make([]geminiFunctionDeclaration, 0, len(tools))
+		for _, tool := range tools {
+			declarations = append(declarations, geminiFunctionDeclaration{Name: tool.Function.Name, Description: tool.Function.Description, Parameters: tool.Function.Parameters})
+		}
+		request.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
+
+	toolConfig, err := geminiToolChoice(toolChoice)
+	if err != nil {
+		return nil, err
+	}
+	request.ToolConfig = toolConfig
+	return request, nil
+}
+
+// geminiToolChoice converts an OpenAI tool_choice value to a Gemini function calling config.
+func geminiToolChoice(toolChoice interface{}) (*geminiToolConfig, error) {
+	config := &geminiToolConfig{}
+	switch choice := toolChoice.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		switch choice {
+		case "auto":
+			config.FunctionCallingConfig.Mode = "AUTO"
+			return config, nil
+		case "none":
+			config.FunctionCallingConfig.Mode = "NONE"
+			return config, nil
+		case "required":
+			config.FunctionCallingConfig.Mode = "ANY"
+			return config, nil
+		}
+	default:
+		// {"type": "function", "function": {"name": ...}}, as a map or a struct
+		encoded, err := json.Marshal(choice)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal tool choice: %w", err)
+		}
+		var named struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(encoded, &named); err == nil && named.Function.Name != "" {
+			config.FunctionCallingConfig.Mode = "ANY"
+			config.FunctionCallingConfig.AllowedFunctionNames = []string{named.Function.Name}
+			return config, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported tool choice: %v", toolChoice)
+}
+
+// geminiFinishReason maps a Gemini finishReason to an OpenAI finish_reason.
+func geminiFinishReason(finishReason string, hasToolCalls bool) string {
+	switch {
+	case hasToolCalls:
+		return "tool_calls"
+	case finishReason == "" || finishReason == "STOP":
+		return "stop"
+	case finishReason == "MAX_TOKENS":
+		return "length"
+	case finishReason == "SAFETY", finishReason == "RECITATION", finishReason == "BLOCKLIST",
+		finishReason == "PROHIBITED_CONTENT", finishReason == "SPII", finishReason == "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	return strings.ToLower(finishReason)
+}
@@ -0,0 +1,153 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGeminiClient(t *testing.T, handler http.HandlerFunc) *GeminiClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	return NewGeminiClient(&GeminiClientConfig{BaseURL: server.URL, APIKey: "test-key", ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+}
+
+func TestGeminiClientCallChatCompletion(t *testing.T) {
+	client := newTestGeminiClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models/test-model:generateContent", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-goog-api-key"))
+
+		var req geminiRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.NotNil(t, req.SystemInstruction)
+		assert.Equal(t, "Be helpful.", req.SystemInstruction.Parts[0].Text)
+		require.Len(t, req.Tools, 1)
+		assert.Equal(t, "echo.echo", req.Tools[0].FunctionDeclarations[0].Name)
+		assert.Nil(t, req.ToolConfig)
+
+		// The two function responses are merged into one turn after the model's function calls.
+		require.Len(t, req.Contents, 3)
+		assert.Equal(t, "user", req.Contents[0].Role)
+		assert.Equal(t, "model", req.Contents[1].Role)
+		require.Len(t, req.Contents[1].Parts, 2)
+		assert.Equal(t, "echo.echo", req.Contents[1].Parts[0].FunctionCall.Name)
+		assert.JSONEq(t, `{"text": "a"}`, string(req.Contents[1].Parts[0].FunctionCall.Args))
+		assert.Equal(t, "user", req.Contents[2].Role)
+		require.Len(t, req.Contents[2].Parts, 2)
+		assert.Equal(t, &geminiFunctionResponse{Name: "echo.echo", Response: map[string]interface{}{"content": "a"}}, req.Contents[2].Parts[0].FunctionResponse)
+		assert.Equal(t, map[string]interface{}{"content": "b"}, req.Contents[2].Parts[1].FunctionResponse.Response)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"candidates": [{"content": {"role": "model", "parts": [
+			{"text": "Echoing again."},
+			{"functionCall": {"name": "echo.echo", "args": {"text": "c"}}}
+		]}, "finishReason": "STOP"}]}`)
+	})
+
+	response, err := client.CallChatCompletion(context.Background(), []Message{
+		{Role: "system", Content: "Be helpful."},
+		{Role: "user", Content: "echo a and b"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "a"}`}},
+			{ID: "call_2", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "b"}`}},
+		}},
+		{Role: "tool", Content: "a", ToolCallID: "call_1", Name: "echo.echo"},
+		{Role: "tool", Content: "b", ToolCallID: "call_2", Name: "echo.echo"},
+	}, []Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo", Parameters: json.RawMessage(`{"type": "object"}`)}}})
+	require.NoError(t, err)
+
+	choice := response.Choices[0]
+	assert.Equal(t, "tool_calls", choice.FinishReason)
+	assert.Equal(t, "Echoing again.", choice.Message.Content)
+	assert.Equal(t, []ToolCall{{Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "c"}`}}}, choice.Message.ToolCalls)
+}
+
+func TestGeminiClientStream(t *testing.T) {
+	client := newTestGeminiClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models/test-model:streamGenerateContent", r.URL.Path)
+		assert.Equal(t, "sse", r.URL.Query().Get("alt"))
+
+		var req geminiRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.NotNil(t, req.ToolConfig)
+		assert.Equal(t, "ANY", req.ToolConfig.FunctionCallingConfig.Mode)
+		assert.Equal(t, []string{"echo.echo"}, req.ToolConfig.FunctionCallingConfig.AllowedFunctionNames)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"candidates": [{"content": {"role": "model", "parts": [{"text": "Hello"}]}}]}`,
+			`{"candidates": [{"content": {"role": "model", "parts": [{"text": " there"}]}, "finishReason": "MAX_TOKENS"}]}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	})
+
+	var deltas []string
+	toolChoice := map[string]interface{}{"type": "function", "function": map[string]string{"name": "echo.echo"}}
+	response, err := client.StreamChatCompletionWithToolChoice(context.Background(), []Message{{Role: "user", Content: "hi"}},
+		[]Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo"}}}, toolChoice, func(delta string) { deltas = append(deltas, delta) })
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Hello", " there"}, deltas)
+	assert.Equal(t, "Hello there", response.Choices[0].Message.Content)
+	assert.Equal(t, "length", response.Choices[0].FinishReason)
+}
+
+func TestGeminiClientBlockedPrompt(t *testing.T) {
+	client := newTestGeminiClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"promptFeedback": {"blockReason": "SAFETY"}}`)
+	})
+
+	_, err := client.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	assert.ErrorContains(t, err, "gemini blocked the prompt: SAFETY")
+}
+
+func TestGeminiClientEchoesThoughtSignature(t *testing.T) {
+	var requests []geminiRequest
+	client := newTestGeminiClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req geminiRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"candidates": [{"content": {"role": "model", "parts": [
+			{"functionCall": {"name": "echo.echo", "args": {"text": "a"}}, "thoughtSignature": "c2lnbmF0dXJl"}
+		]}, "finishReason": "STOP"}]}`)
+	})
+
+	messages := []Message{{Role: "user", Content: "echo a"}}
+	response, err := client.CallChatCompletion(context.Background(), messages, nil)
+	require.NoError(t, err)
+	toolCalls := response.Choices[0].Message.ToolCalls
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, "c2lnbmF0dXJl", toolCalls[0].thoughtSignature)
+
+	// The signature is not part of the tool call's JSON, so other providers never see it.
+	encoded, err := json.Marshal(toolCalls[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "c2lnbmF0dXJl")
+
+	messages = append(messages,
+		Message{Role: "assistant", ToolCalls: toolCalls},
+		Message{Role: "tool", Content: "a", ToolCallID: "call_1", Name: "echo.echo"},
+	)
+	_, err = client.CallChatCompletion(context.Background(), messages, nil)
+	require.NoError(t, err)
+
+	require.Len(t, requests, 2)
+	require.Len(t, requests[1].Contents, 3)
+	part := requests[1].Contents[1].Parts[0]
+	require.NotNil(t, part.FunctionCall)
+	assert.Equal(t, "c2lnbmF0dXJl", part.ThoughtSignature)
+}
@@ -0,0 +1,201 @@
+package go_as
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Kinds of fixes made by repairJSON.
+const (
+	JSONFixCodeFence        = "code_fence"
+	JSONFixTrailingComma    = "trailing_comma"
+	JSONFixSingleQuotes     = "single_quotes"
+	JSONFixControlCharacter = "control_character"
+)
+
+// Sources of the JSON texts repaired, as reported by JSONRepairRecorder.Stats.
+const (
+	JSONSourceToolArguments = "tool_arguments"  // FunctionCall.Arguments of a tool call
+	JSONSourceTextToolCalls = "text_tool_calls" // Tool calls found in the text of an LLM response
+)
+
+// JSONRepairMetrics counts the malformed JSON received from the LLM from one source.
+type JSONRepairMetrics struct {
+	Checked  int64            `json:"checked"`  // JSON texts received
+	Repaired int64            `json:"repaired"` // Texts that were malformed and repaired
+	Failed   int64            `json:"failed"`   // Texts that were malformed beyond repair
+	Fixes    map[string]int64 `json:"fixes"`    // Repaired texts by kind of fix; a text may need several
+}
+
+// JSONRepairRecorder counts, by source, how often JSON from the LLM needed repairing. The
+// Orchestrator keeps one for all of its agents; a nil recorder counts nothing.
+type JSONRepairRecorder struct {
+	mu       sync.Mutex
+	bySource map[string]*JSONRepairMetrics
+}
+
+// NewJSONRepairRecorder creates an empty JSONRepairRecorder.
+func NewJSONRepairRecorder() *JSONRepairRecorder {
+	return &JSONRepairRecorder{bySource: make(map[string]*JSONRepairMetrics)}
+}
+
+// Stats returns, by source, how often JSON from the LLM needed repairing.
+func (r *JSONRepairRecorder) Stats() map[string]JSONRepairMetrics {
+	stats := make(map[string]JSONRepairMetrics)
+	if r == nil {
+		return stats
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for source, metrics := range r.bySource {
+		snapshot := *metrics
+		snapshot.Fixes = make(map[string]int64, len(metrics.Fixes))
+		for fix, count := range metrics.Fixes {
+			snapshot.Fixes[fix] = count
+		}
+		stats[source] = snapshot
+	}
+	return stats
+}
+
+func (r *JSONRepairRecorder) record(source string, fixes []string, ok bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	metrics, found := r.bySource[source]
+	if !found {
+		metrics = &JSONRepairMetrics{Fixes: make(map[string]int64)}
+		r.bySource[source] = metrics
+	}
+	metrics.Checked++
+	switch {
+	case !ok:
+		metrics.Failed++
+	case len(fixes) > 0:
+		metrics.Repaired++
+		for _, fix := range fixes {
+			metrics.Fixes[fix]++
+		}
+	}
+}
+
+// repair returns text, repaired if needed, and records the outcome for source.
+// ok is false if text is not valid JSON even after repair; text is then returned unchanged.
+func (r *JSONRepairRecorder) repair(source string, text string) (repaired string, fixes []string, ok bool) {
+	repaired, fixes, ok = repairJSON(text)
+	r.record(source, fixes, ok)
+	if !ok {
+		return text, nil, false
+	}
+	return repaired, fixes, true
+}
+
+// repairJSON fixes the mistakes local models commonly make when writing JSON: a surrounding
+// markdown code fence, trailing commas, single-quoted strings, and newlines or other control
+// characters left unescaped inside strings. It returns the repaired text, the kinds of fixes
+// made, and whether the result is valid JSON. Valid JSON is returned as is.
+func repairJSON(text string) (string, []string, bool) {
+	if json.Valid([]byte(text)) {
+		return text, nil, true
+	}
+
+	var fixes []string
+	addFix := func(fix string) {
+		if !containsString(fixes, fix) {
+			fixes = append(fixes, fix)
+		}
+	}
+
+	if unfenced, ok := stripCodeFence(text); ok {
+		text = unfenced
+		addFix(JSONFixCodeFence)
+	}
+
+	var builder strings.Builder
+	var quote rune // Quote character of the string being copied; 0 outside strings
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if quote == 0 {
+			switch {
+			case r == '"':
+				quote = r
+				builder.WriteRune(r)
+			case r == '\'':
+				quote = r
+				builder.WriteRune('"')
+				addFix(JSONFixSingleQuotes)
+			case r == ',' && closesAfterWhitespace(runes[i+1:]):
+				addFix(JSONFixTrailingComma)
+			default:
+				builder.WriteRune(r)
+			}
+			continue
+		}
+
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			if runes[i] == '\'' {
+				builder.WriteRune('\'') // \' is not a valid JSON escape
+			} else {
+				builder.WriteRune(r)
+				builder.WriteRune(runes[i])
+			}
+		case r == quote:
+			quote = 0
+			builder.WriteRune('"')
+		case r == '"': // Inside a single-quoted string
+			builder.WriteString(`\"`)
+		case r < 0x20:
+			addFix(JSONFixControlCharacter)
+			switch r {
+			case '\n':
+				builder.WriteString(`\n`)
+			case '\r':
+				builder.WriteString(`\r`)
+			case '\t':
+				builder.WriteString(`\t`)
+			default:
+				builder.WriteString(fmt.Sprintf(`\u%04x`, r))
+			}
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	repaired := builder.String()
+	return repaired, fixes, json.Valid([]byte(repaired))
+}
+
+// stripCodeFence returns the content of a markdown code fence (```json ... ```) around text.
+func stripCodeFence(text string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") || len(trimmed) < 6 {
+		return text, false
+	}
+	content := strings.TrimSuffix(trimmed[3:], "```")
+	// Drop the info string (e.g. "json") on the opening line.
+	if newline := strings.IndexByte(content, '\n'); newline >= 0 && !strings.ContainsAny(content[:newline], "{[") {
+		content = content[newline+1:]
+	}
+	return strings.TrimSpace(content), true
+}
+
+// closesAfterWhitespace reports whether runes continue with whitespace and then '}' or ']'.
+func closesAfterWhitespace(runes []rune) bool {
+	for _, r := range runes {
+		switch r {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '}', ']':
+			return true
+		}
+		return false
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package go_as
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      string
+		wantFixes []string
+		wantOK    bool
+	}{
+		{name: "valid", input: `{"a": [1, 2]}`, want: `{"a": [1, 2]}`, wantOK: true},
+		{name: "trailing commas", input: `{"a": [1, 2,], "b": 3,}`, want: `{"a": [1, 2], "b": 3}`, wantFixes: []string{JSONFixTrailingComma}, wantOK: true},
+		{name: "comma inside string kept", input: `{"a": "x,}",}`, want: `{"a": "x,}"}`, wantFixes: []string{JSONFixTrailingComma}, wantOK: true},
+		{name: "single quotes", input: `{'path': 'it\'s "here"'}`, want: `{"path": "it's \"here\""}`, wantFixes: []string{JSONFixSingleQuotes}, wantOK: true},
+		{name: "unescaped newline", input: "{\"text\": \"line 1\nline 2\tend\"}", want: `{"text": "line 1\nline 2\tend"}`, wantFixes: []string{JSONFixControlCharacter}, wantOK: true},
+		{name: "code fence", input: "```json\n{\"a\": 1}\n```", want: `{"a": 1}`, wantFixes: []string{JSONFixCodeFence}, wantOK: true},
+		{
+			name:      "several fixes",
+			input:     "```\n{'a': 'x\ny',}\n```",
+			want:      `{"a": "x\ny"}`,
+			wantFixes: []string{JSONFixCodeFence, JSONFixSingleQuotes, JSONFixControlCharacter, JSONFixTrailingComma},
+			wantOK:    true,
+		},
+		{name: "beyond repair", input: `{"a": }`, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fixes, ok := repairJSON(tt.input)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+				assert.Equal(t, tt.wantFixes, fixes)
+			}
+		})
+	}
+}
+
+func TestAgentRepairsMalformedToolCalls(t *testing.T) {
+	var requests [][]Message
+	agent := newStrategyTestAgent(t, []Message{
+		// Text tool calls with a trailing comma, and arguments in single quotes.
+		{Role: "assistant", Content: `<plan>
+1. Echo.
+</plan>
+[{"function": {"name": "echo.echo", "arguments": "{'text': 'hi'}",},}]`},
+		{Role: "assistant", Content: "Final answer"},
+	}, &requests)
+	recorder := NewJSONRepairRecorder()
+	agent.SetJSONRepairRecorder(recorder)
+
+	finalResult, err := agent.Execute(context.Background(), "echo hi")
+	require.NoError(t, err)
+	assert.Equal(t, "Final answer", finalResult)
+
+	require.Len(t, requests, 2)
+	last := requests[1][len(requests[1])-1]
+	assert.Equal(t, "tool", last.Role)
+	assert.Equal(t, "hi", last.Content)
+
+	stats := recorder.Stats()
+	textToolCalls := stats[JSONSourceTextToolCalls]
+	assert.Equal(t, int64(1), textToolCalls.Fixes[JSONFixTrailingComma])
+	assert.Equal(t, int64(1), textToolCalls.Repaired)
+	arguments := stats[JSONSourceToolArguments]
+	assert.Equal(t, int64(1), arguments.Fixes[JSONFixSingleQuotes])
+	assert.Equal(t, int64(1), arguments.Repaired)
+}
@@ -0,0 +1,152 @@
+package go_as
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// jsonCandidate is a balanced JSON object or array found in free text.
+type jsonCandidate struct {
+	start, end int // Byte offsets of the value in the text; end is exclusive
+	text       string
+}
+
+// nextJSONCandidate returns the first JSON object or array in text at or after offset from.
+// The scanner tracks bracket nesting and string literals, so braces inside strings and prose
+// before or after the value are handled. Local models write single quoted strings as well as
+// double quoted ones, but apostrophes are common in prose, so a single quote only starts a
+// string where a JSON string can: after '{', '[', ':' or ','. A value whose brackets are
+// mismatched or never closed is skipped, and scanning resumes just after its opening bracket
+// so that values nested in it can still be found. Callers that cannot parse a candidate
+// should likewise scan again from just after its start.
+func nextJSONCandidate(text string, from int) (jsonCandidate, bool) {
+	for start := from; start < len(text); start++ {
+		if text[start] != '{' && text[start] != '[' {
+			continue
+		}
+		if end, ok := scanJSONValue(text, start); ok {
+			return jsonCandidate{start: start, end: end, text: text[start:end]}, true
+		}
+	}
+	return jsonCandidate{}, false
+}
+
+// scanJSONValue returns the end of the object or array starting at text[start], if its
+// brackets balance.
+func scanJSONValue(text string, start int) (int, bool) {
+	var stack []byte // Closing brackets expected, innermost last
+	var quote byte   // Quote of the string being scanned; 0 outside strings
+	var prev byte    // Last character outside strings and whitespace
+	escaped := false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+				prev = c
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '"':
+			quote = c
+		case '\'':
+			if strings.IndexByte("{[:,", prev) >= 0 {
+				quote = c
+			}
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if stack[len(stack)-1] != c {
+				return 0, false
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i + 1, true
+			}
+		}
+		prev = c
+	}
+	return 0, false
+}
+
+// toolCallsFromJSON returns the tool calls described by a JSON value from the model's text:
+// the {"tool_calls": [...]} envelope the prompts ask for, an array of tool calls, or a single
+// tool call. Tool calls may be OpenAI-style ({"function": {"name", "arguments"}}) or flat
+// ({"name", "arguments"}), with the arguments as a JSON string or an object. isToolCalls is
+// false if the value is some other JSON, such as a structured plan.
+func toolCallsFromJSON(value interface{}) (toolCalls []ToolCall, isToolCalls bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if envelope, ok := value["tool_calls"]; ok {
+			entries, _ := envelope.([]interface{})
+			for _, entry := range entries {
+				if toolCall, ok := toolCallFromJSON(entry); ok {
+					toolCalls = append(toolCalls, toolCall)
+				}
+			}
+			return toolCalls, true
+		}
+		if toolCall, ok := toolCallFromJSON(value); ok {
+			return []ToolCall{toolCall}, true
+		}
+	case []interface{}:
+		for _, entry := range value {
+			if toolCall, ok := toolCallFromJSON(entry); ok {
+				toolCalls = append(toolCalls, toolCall)
+			}
+		}
+		return toolCalls, len(toolCalls) > 0
+	}
+	return nil, false
+}
+
+// toolCallFromJSON converts one tool call object to a ToolCall.
+func toolCallFromJSON(value interface{}) (ToolCall, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return ToolCall{}, false
+	}
+	function, ok := object["function"].(map[string]interface{})
+	if !ok {
+		_, hasName := object["name"].(string)
+		_, hasArguments := object["arguments"]
+		if !hasName || !hasArguments {
+			return ToolCall{}, false
+		}
+		function = object // Flat form
+	}
+
+	toolCall := ToolCall{}
+	toolCall.ID, _ = object["id"].(string)
+	toolCall.Type, _ = object["type"].(string)
+	toolCall.Function.Name, _ = function["name"].(string)
+	switch arguments := function["arguments"].(type) {
+	case string:
+		toolCall.Function.Arguments = arguments
+	case nil:
+		toolCall.Function.Arguments = "{}"
+	default:
+		encoded, err := json.Marshal(arguments)
+		if err != nil {
+			return ToolCall{}, false
+		}
+		toolCall.Function.Arguments = string(encoded)
+	}
+	return toolCall, true
+}
+
+// looksLikeToolCalls reports whether malformed JSON was probably meant as tool calls, so that
+// failing to repair it is worth counting.
+func looksLikeToolCalls(text string) bool {
+	return strings.Contains(text, "tool_calls") || strings.Contains(text, "function")
+}
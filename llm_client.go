@@ -18,15 +18,23 @@ import (
 type LLMClientConfig struct {
 	ServerURL string
 	ModelName string
+	APIKey    string // Sent as a bearer token; empty sends none
 	Timeout   time.Duration
+	Retry     *LLMRetryPolicy // Retries of failed requests; nil uses DefaultLLMRetryPolicy
 	// MaxTokens removed as per user's request for debugging
 }
 
 // Message represents a message in the chat completion.
 type Message struct {
-	Role      string     `json:"role"`
-	Content   string     `json:"content"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Set on "tool" messages: the ToolCall.ID the result answers
+	Name       string     `json:"name,omitempty"`         // Set on "tool" messages: the name of the function that was called
+
+	// toolFailed is set on "tool" messages whose call failed, for providers that flag failed
+	// results, such as Anthropic's is_error. It is never serialized.
+	toolFailed bool
 }
 
 // ToolCall represents a tool call made by the LLM.
@@ -34,6 +42,11 @@ type ToolCall struct {
 	ID       string       `json:"id,omitempty"`
 	Type     string       `json:"type"`
 	Function FunctionCall `json:"function"`
+
+	// thoughtSignature is the opaque signature Gemini attaches to a function call of a
+	// thinking model, which must be sent back with the call in later turns. It is never
+	// serialized, so other providers do not see it.
+	thoughtSignature string
 }
 
 // FunctionCall represents a function call within a tool call.
@@ -84,24 +97,38 @@ type ChatCompletionRequest struct {
 
 // ChatCompletionResponse represents the response body for chat completions.
 type ChatCompletionResponse struct {
-	Choices []struct {
-		Message      Message `json:"message"`
-		FinishReason string  `json:"finish_reason"`
-		Index        int     `json:"index"`
-	} `json:"choices"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Model   string                 `json:"model,omitempty"` // Model that produced the response, as named in the provider's configuration
+}
+
+// ChatCompletionChoice represents a single choice in a chat completion response.
+type ChatCompletionChoice struct {
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+	Index        int     `json:"index"`
 }
 
 // ChatCompletionStreamChunk represents a chunk in a streaming chat completion.
 type ChatCompletionStreamChunk struct {
 	Choices []struct {
-		Delta Delta `json:"delta"`
+		Delta        Delta  `json:"delta"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 }
 
 // Delta represents a change in content in a streaming response.
 type Delta struct {
-	Content   string     `json:"content"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Content   string          `json:"content"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta represents a fragment of a tool call in a streaming response.
+// Fragments with the same Index belong to the same tool call.
+type ToolCallDelta struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
 }
 
 // CallChatCompletion sends a chat completion request to the LLM.
@@ -123,24 +150,13 @@ func (c *LLMClient) CallChatCompletionWithToolChoice(ctx context.Context, messag
 		return nil, fmt.Errorf("could not marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.config.ServerURL, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("could not create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
 	c.logger.Info("Sending LLM request", "url", c.config.ServerURL, "model", c.config.ModelName)
-	resp, err := c.client.Do(req)
+	resp, err := c.do(ctx, requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("non-OK status: %d, body: %s", resp.StatusCode, respBody)
-	}
-
 	var llmResponse ChatCompletionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&llmResponse); err != nil {
 		return nil, fmt.Errorf("could not decode response body: %w", err)
@@ -150,6 +166,7 @@ func (c *LLMClient) CallChatCompletionWithToolChoice(ctx context.Context, messag
 		return nil, fmt.Errorf("no choices in LLM response")
 	}
 
+	llmResponse.Model = c.config.ModelName
 	return &llmResponse, nil
 }
 
@@ -166,24 +183,13 @@ func (c *LLMClient) StreamChatCompletion(ctx context.Context, messages []Message
 		return fmt.Errorf("could not marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.config.ServerURL, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return fmt.Errorf("could not create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
 	c.logger.Info("Sending streaming LLM request", "url", c.config.ServerURL, "model", c.config.ModelName)
-	resp, err := c.client.Do(req)
+	resp, err := c.do(ctx, requestBody)
 	if err != nil {
-		return fmt.Errorf("error sending request: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("non-OK status: %d, body: %s", resp.StatusCode, respBody)
-	}
-
 	reader := bufio.NewReader(resp.Body)
 	var buffer []byte
 
@@ -239,6 +245,130 @@ func (c *LLMClient) StreamChatCompletion(ctx context.Context, messages []Message
 	}
 }
 
+// StreamChatCompletionWithToolChoice sends a streaming chat completion request and assembles
+// the streamed deltas, including tool call fragments, into a regular ChatCompletionResponse.
+// onDelta is called with every content fragment as it arrives. If the server ignores the
+// stream flag and answers with plain JSON, the whole content is delivered as a single delta.
+func (c *LLMClient) StreamChatCompletionWithToolChoice(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, onDelta func(string)) (*ChatCompletionResponse, error) {
+	requestBody, err := json.Marshal(ChatCompletionRequest{
+		Model:      c.config.ModelName,
+		Messages:   messages,
+		Tools:      tools,
+		ToolChoice: toolChoice,
+		Stream:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request body: %w", err)
+	}
+
+	c.logger.Info("Sending streaming LLM request", "url", c.config.ServerURL, "model", c.config.ModelName)
+	resp, err := c.do(ctx, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var llmResponse ChatCompletionResponse
+		if err := json.NewDecoder(resp.Body).Decode(&llmResponse); err != nil {
+			return nil, fmt.Errorf("could not decode response body: %w", err)
+		}
+		if len(llmResponse.Choices) == 0 {
+			return nil, fmt.Errorf("no choices in LLM response")
+		}
+		if content := llmResponse.Choices[0].Message.Content; content != "" && onDelta != nil {
+			onDelta(content)
+		}
+		llmResponse.Model = c.config.ModelName
+		return &llmResponse, nil
+	}
+
+	var content strings.Builder
+	var finishReason string
+	var toolCalls []ToolCall
+	toolCallIdx := make(map[int]int) // Stream index -> position in toolCalls
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+
+		if line == "data: [DONE]" {
+			break
+		}
+		if strings.HasPrefix(line, "data:") {
+			jsonStr := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			var streamChunk ChatCompletionStreamChunk
+			if unmarshalErr := json.Unmarshal([]byte(jsonStr), &streamChunk); unmarshalErr != nil {
+				c.logger.Warn("Warning: Error unmarshaling JSON chunk", "error", unmarshalErr, "data", jsonStr)
+			} else {
+				for _, choice := range streamChunk.Choices {
+					if choice.Delta.Content != "" {
+						content.WriteString(choice.Delta.Content)
+						if onDelta != nil {
+							onDelta(choice.Delta.Content)
+						}
+					}
+					for _, tc := range choice.Delta.ToolCalls {
+						pos, ok := toolCallIdx[tc.Index]
+						if !ok {
+							pos = len(toolCalls)
+							toolCallIdx[tc.Index] = pos
+							toolCalls = append(toolCalls, ToolCall{Type: "function"})
+						}
+						if tc.ID != "" {
+							toolCalls[pos].ID = tc.ID
+						}
+						if tc.Type != "" {
+							toolCalls[pos].Type = tc.Type
+						}
+						toolCalls[pos].Function.Name += tc.Function.Name
+						toolCalls[pos].Function.Arguments += tc.Function.Arguments
+					}
+					if choice.FinishReason != "" {
+						finishReason = choice.FinishReason
+					}
+				}
+			}
+		}
+
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading stream: %w", readErr)
+		}
+	}
+
+	return &ChatCompletionResponse{
+		Choices: []ChatCompletionChoice{{
+			Message: Message{
+				Role:      "assistant",
+				Content:   content.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: finishReason,
+		}},
+		Model: c.config.ModelName,
+	}, nil
+}
+
+// do posts requestBody to the server, retrying transient failures according to the
+// configured policy, and returns the 200 OK response.
+func (c *LLMClient) do(ctx context.Context, requestBody []byte) (*http.Response, error) {
+	return doLLMRequest(ctx, c.client, llmRetryPolicy(c.config.Retry), c.logger, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.config.ServerURL, bytes.NewReader(requestBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.config.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+		}
+		return req, nil
+	})
+}
+
 func extractLine(buffer *[]byte) (string, error) {
 	idx := bytes.IndexByte(*buffer, '\n')
 	if idx == -1 {
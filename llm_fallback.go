@@ -0,0 +1,226 @@
+package go_as
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LLMFallbackProvider is one of the providers an LLMFallback tries, with the name its health
+// is reported under.
+type LLMFallbackProvider struct {
+	Name     string
+	Provider LLMProvider
+}
+
+// Circuit states reported in LLMProviderHealth.
+const (
+	CircuitClosed   = "closed"    // The provider receives requests
+	CircuitOpen     = "open"      // The provider is skipped until its cooldown ends
+	CircuitHalfOpen = "half_open" // The cooldown has ended; the next request is a trial
+)
+
+// LLMProviderHealth is the health of one provider of an LLMFallback.
+type LLMProviderHealth struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"` // CircuitClosed, CircuitOpen or CircuitHalfOpen
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"` // Set while the circuit is open
+}
+
+// ErrLLMUnavailable is returned when every provider of an LLMFallback is skipped because its
+// circuit is open.
+var ErrLLMUnavailable = errors.New("all LLM providers are unavailable")
+
+// LLMFallback is an LLMProvider that fails over between providers, for instance from a local
+// llama server to a hosted model. Each request goes to the first provider whose circuit is
+// not open, and to the next one if it fails after the provider's own retries with a transport
+// error, a timeout or a retryable status. Other errors, such as a 400 or 401, are returned as
+// they are and do not count against the provider. A streamed response fails over only until
+// its first content fragment has been delivered, so no tokens are repeated.
+type LLMFallback struct {
+	logger    *slog.Logger
+	providers []*fallbackProvider
+}
+
+// NewLLMFallback creates an LLMFallback trying providers in order, each with a circuit breaker
+// following policy; a nil policy uses DefaultCircuitBreakerPolicy.
+func NewLLMFallback(providers []LLMFallbackProvider, policy *CircuitBreakerPolicy, logger *slog.Logger) *LLMFallback {
+	f := &LLMFallback{logger: logger}
+	for _, provider := range providers {
+		f.providers = append(f.providers, newFallbackProvider(provider, policy))
+	}
+	return f
+}
+
+// CallChatCompletion sends the request to the first provider that answers it.
+func (f *LLMFallback) CallChatCompletion(ctx context.Context, messages []Message, tools []Tool) (*ChatCompletionResponse, error) {
+	return f.do(ctx, nil, func(provider LLMProvider) (*ChatCompletionResponse, error) {
+		return provider.CallChatCompletion(ctx, messages, tools)
+	})
+}
+
+// StreamChatCompletionWithToolChoice streams the response of the first provider that answers
+// the request. Once a fragment has been passed to onDelta, a failure is returned as is.
+func (f *LLMFallback) StreamChatCompletionWithToolChoice(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, onDelta func(string)) (*ChatCompletionResponse, error) {
+	streamed := false
+	return f.do(ctx, &streamed, func(provider LLMProvider) (*ChatCompletionResponse, error) {
+		return provider.StreamChatCompletionWithToolChoice(ctx, messages, tools, toolChoice, func(delta string) {
+			streamed = true
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		})
+	})
+}
+
+// do sends a request with send to each provider in turn until one succeeds. If streamed is
+// set once a provider fails, its content has been delivered and the request does not fail over.
+func (f *LLMFallback) do(ctx context.Context, streamed *bool, send func(LLMProvider) (*ChatCompletionResponse, error)) (*ChatCompletionResponse, error) {
+	var failures []error
+	var lastErr error
+	for _, provider := range f.providers {
+		if !provider.acquire(time.Now()) {
+			f.logger.Info("Skipping LLM provider with an open circuit.", "provider", provider.Name)
+			continue
+		}
+
+		response, err := send(provider.Provider)
+		provider.record(ctx, err, time.Now())
+		if err == nil {
+			if response.Model == "" {
+				response.Model = provider.Name
+			}
+			return response, nil
+		}
+		if ctx.Err() != nil || (streamed != nil && *streamed) || !providerFailure(err) {
+			return nil, err
+		}
+		f.logger.Warn("LLM provider failed.", "provider", provider.Name, "error", err)
+		failures = append(failures, fmt.Errorf("%s: %w", provider.Name, err))
+		lastErr = err
+	}
+
+	switch len(failures) {
+	case 0:
+		return nil, ErrLLMUnavailable
+	case 1:
+		return nil, lastErr
+	default:
+		return nil, fmt.Errorf("all LLM providers failed: %w", errors.Join(failures...))
+	}
+}
+
+// providerFailure reports whether err, returned by a provider, says the provider is unhealthy:
+// a transport error, a timeout, a server error or another retryable status. Other statuses
+// are caused by the request or the provider's configuration, and are reported rather than
+// hidden by failing over.
+func providerFailure(err error) bool {
+	var statusErr *LLMStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || slices.Contains(DefaultRetryableStatusCodes, statusErr.StatusCode)
+	}
+	return true
+}
+
+// Health reports the health of the providers, in the order they are tried.
+func (f *LLMFallback) Health() []LLMProviderHealth {
+	now := time.Now()
+	health := make([]LLMProviderHealth, 0, len(f.providers))
+	for _, provider := range f.providers {
+		health = append(health, provider.health(now))
+	}
+	return health
+}
+
+// fallbackProvider is a provider of an LLMFallback with its circuit breaker.
+type fallbackProvider struct {
+	LLMFallbackProvider
+	policy CircuitBreakerPolicy
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+	trialInFlight       bool // A trial request is being sent after the cooldown
+	lastErr             error
+	lastFailure         time.Time
+}
+
+func newFallbackProvider(provider LLMFallbackProvider, policy *CircuitBreakerPolicy) *fallbackProvider {
+	p := &fallbackProvider{LLMFallbackProvider: provider, policy: DefaultCircuitBreakerPolicy()}
+	if policy != nil {
+		p.policy = *policy
+	}
+	return p
+}
+
+// tripped reports whether enough requests failed in a row to open the circuit. The caller holds p.mu.
+func (p *fallbackProvider) tripped() bool {
+	return p.policy.FailureThreshold > 0 && p.consecutiveFailures >= p.policy.FailureThreshold
+}
+
+// acquire reports whether a request may be sent to the provider now. Once the cooldown of an
+// open circuit ends, a single trial request is let through until its outcome is recorded.
+func (p *fallbackProvider) acquire(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.tripped() {
+		return true
+	}
+	if now.Before(p.openUntil) || p.trialInFlight {
+		return false
+	}
+	p.trialInFlight = true
+	return true
+}
+
+// record updates the provider's health with the outcome of a request let through by acquire.
+// A request abandoned because ctx ended, or refused for a reason other than the provider's
+// health, says nothing about the provider and is not counted.
+func (p *fallbackProvider) record(ctx context.Context, err error, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trialInFlight = false
+	switch {
+	case err == nil:
+		p.consecutiveFailures = 0
+	case ctx.Err() != nil, !providerFailure(err):
+	default:
+		p.consecutiveFailures++
+		p.lastErr = err
+		p.lastFailure = now
+		if p.tripped() {
+			p.openUntil = now.Add(p.policy.Cooldown)
+		}
+	}
+}
+
+func (p *fallbackProvider) health(now time.Time) LLMProviderHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	health := LLMProviderHealth{
+		Name:                p.Name,
+		State:               CircuitClosed,
+		ConsecutiveFailures: p.consecutiveFailures,
+	}
+	if p.lastErr != nil {
+		health.LastError = p.lastErr.Error()
+		lastFailure := p.lastFailure
+		health.LastFailure = &lastFailure
+	}
+	if p.tripped() {
+		health.State = CircuitHalfOpen
+		if now.Before(p.openUntil) {
+			openUntil := p.openUntil
+			health.State = CircuitOpen
+			health.OpenUntil = &openUntil
+		}
+	}
+	return health
+}
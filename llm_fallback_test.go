@@ -0,0 +1,272 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newModelServer returns an OpenAI-compatible server that answers "ok" while healthy and
+// 503 otherwise, counting the requests it receives.
+func newModelServer(t *testing.T, healthy *atomic.Bool, hits *atomic.Int32, requests chan<- *http.Request) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if requests != nil {
+			requests <- r
+		}
+		if !healthy.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Model: "server-reported", Choices: []ChatCompletionChoice{{Message: Message{Role: "assistant", Content: "ok from " + req.Model}, FinishReason: "stop"}}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestFallback returns an LLMFallback over an LLMClient for each of servers, named after
+// models, that do not retry.
+func newTestFallback(servers []*httptest.Server, models []string, apiKeys []string, policy *CircuitBreakerPolicy) *LLMFallback {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	var providers []LLMFallbackProvider
+	for i, server := range servers {
+		llmClient := NewLLMClient(&LLMClientConfig{
+			ServerURL: server.URL,
+			ModelName: models[i],
+			APIKey:    apiKeys[i],
+			Timeout:   5 * time.Second,
+			Retry:     &LLMRetryPolicy{MaxAttempts: 1},
+		}, logger)
+		providers = append(providers, LLMFallbackProvider{Name: models[i], Provider: llmClient})
+	}
+	return NewLLMFallback(providers, policy, logger)
+}
+
+func TestLLMFallbackFailsOver(t *testing.T) {
+	var primaryHealthy, backupHealthy atomic.Bool
+	var primaryHits, backupHits atomic.Int32
+	backupHealthy.Store(true)
+	backupRequests := make(chan *http.Request, 10)
+	primary := newModelServer(t, &primaryHealthy, &primaryHits, nil)
+	backup := newModelServer(t, &backupHealthy, &backupHits, backupRequests)
+
+	fallback := newTestFallback([]*httptest.Server{primary, backup}, []string{"primary-model", "backup-model"}, []string{"", "secret"},
+		&CircuitBreakerPolicy{FailureThreshold: 2, Cooldown: 200 * time.Millisecond})
+	call := func() *ChatCompletionResponse {
+		response, err := fallback.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+		require.NoError(t, err)
+		return response
+	}
+
+	// The failing primary is tried first until its circuit opens.
+	response := call()
+	assert.Equal(t, "backup-model", response.Model)
+	assert.Equal(t, "ok from backup-model", response.Choices[0].Message.Content)
+	assert.Equal(t, "Bearer secret", (<-backupRequests).Header.Get("Authorization"))
+	health := fallback.Health()
+	require.Len(t, health, 2)
+	assert.Equal(t, "primary-model", health[0].Name)
+	assert.Equal(t, CircuitClosed, health[0].State)
+	assert.Equal(t, 1, health[0].ConsecutiveFailures)
+	assert.Contains(t, health[0].LastError, "503")
+	assert.NotNil(t, health[0].LastFailure)
+	assert.Nil(t, health[1].LastFailure)
+
+	call()
+	health = fallback.Health()
+	assert.Equal(t, CircuitOpen, health[0].State)
+	assert.NotNil(t, health[0].OpenUntil)
+	assert.Equal(t, CircuitClosed, health[1].State)
+
+	// While the circuit is open the primary is skipped.
+	assert.Equal(t, "backup-model", call().Model)
+	assert.Equal(t, int32(2), primaryHits.Load())
+	assert.Equal(t, int32(3), backupHits.Load())
+
+	// After the cooldown a trial request goes to the primary, which has recovered.
+	primaryHealthy.Store(true)
+	time.Sleep(250 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, fallback.Health()[0].State)
+	assert.Equal(t, "primary-model", call().Model)
+	health = fallback.Health()
+	assert.Equal(t, CircuitClosed, health[0].State)
+	assert.Equal(t, 0, health[0].ConsecutiveFailures)
+	assert.Nil(t, health[0].OpenUntil)
+	assert.Equal(t, int32(3), backupHits.Load())
+}
+
+func TestLLMFallbackReturnsClientErrors(t *testing.T) {
+	var backupHealthy atomic.Bool
+	var primaryHits, backupHits atomic.Int32
+	backupHealthy.Store(true)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+	}))
+	t.Cleanup(primary.Close)
+	backup := newModelServer(t, &backupHealthy, &backupHits, nil)
+
+	fallback := newTestFallback([]*httptest.Server{primary, backup}, []string{"primary-model", "backup-model"}, []string{"", ""},
+		&CircuitBreakerPolicy{FailureThreshold: 1, Cooldown: time.Minute})
+
+	// A client error is returned as is, without failing over or opening the circuit.
+	for i := 0; i < 2; i++ {
+		_, err := fallback.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+		var statusErr *LLMStatusError
+		require.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+	}
+	assert.Equal(t, int32(2), primaryHits.Load())
+	assert.Equal(t, int32(0), backupHits.Load())
+	health := fallback.Health()
+	assert.Equal(t, CircuitClosed, health[0].State)
+	assert.Equal(t, 0, health[0].ConsecutiveFailures)
+}
+
+func TestLLMFallbackAllProvidersFailing(t *testing.T) {
+	var primaryHealthy, backupHealthy atomic.Bool
+	var primaryHits, backupHits atomic.Int32
+	primary := newModelServer(t, &primaryHealthy, &primaryHits, nil)
+	backup := newModelServer(t, &backupHealthy, &backupHits, nil)
+
+	fallback := newTestFallback([]*httptest.Server{primary, backup}, []string{"primary-model", "backup-model"}, []string{"", ""},
+		&CircuitBreakerPolicy{FailureThreshold: 1, Cooldown: time.Minute})
+
+	_, err := fallback.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	assert.ErrorContains(t, err, "all LLM providers failed")
+	assert.ErrorContains(t, err, "backup-model")
+	var statusErr *LLMStatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+
+	// Both circuits are open now: the next request fails without being sent.
+	_, err = fallback.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	assert.ErrorIs(t, err, ErrLLMUnavailable)
+	assert.Equal(t, int32(1), primaryHits.Load())
+	assert.Equal(t, int32(1), backupHits.Load())
+}
+
+// brokenStreamProvider streams a fragment and then fails.
+type brokenStreamProvider struct{}
+
+func (brokenStreamProvider) CallChatCompletion(ctx context.Context, messages []Message, tools []Tool) (*ChatCompletionResponse, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (brokenStreamProvider) StreamChatCompletionWithToolChoice(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, onDelta func(string)) (*ChatCompletionResponse, error) {
+	onDelta("Hel")
+	return nil, errors.New("stream broken")
+}
+
+func TestLLMFallbackDoesNotRepeatStreamedContent(t *testing.T) {
+	var backupHealthy atomic.Bool
+	var backupHits atomic.Int32
+	backupHealthy.Store(true)
+	backup := newModelServer(t, &backupHealthy, &backupHits, nil)
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	fallback := NewLLMFallback([]LLMFallbackProvider{
+		{Name: "broken", Provider: brokenStreamProvider{}},
+		{Name: "backup-model", Provider: NewLLMClient(&LLMClientConfig{ServerURL: backup.URL, ModelName: "backup-model", Timeout: 5 * time.Second}, logger)},
+	}, nil, logger)
+
+	// A request that fails before streaming anything fails over.
+	response, err := fallback.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "backup-model", response.Model)
+
+	// Once a fragment has been delivered, the failure is returned instead.
+	var deltas []string
+	_, err = fallback.StreamChatCompletionWithToolChoice(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, nil, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	assert.ErrorContains(t, err, "stream broken")
+	assert.Equal(t, []string{"Hel"}, deltas)
+	assert.Equal(t, int32(1), backupHits.Load())
+	assert.Equal(t, 2, fallback.Health()[0].ConsecutiveFailures)
+}
+
+func TestExecuteTaskReportsModel(t *testing.T) {
+	var calls atomic.Int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := Message{Role: "assistant", Content: "Done"}
+		if calls.Add(1) == 1 {
+			message = Message{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "hi"}`}}}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+	}))
+	defer backup.Close()
+	primary := httptest.NewServer(http.NotFoundHandler())
+	primary.Close() // Connections to the primary are refused
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := newTestFallback([]*httptest.Server{primary, backup}, []string{"primary-model", "backup-model"}, []string{"", ""}, nil)
+	orchestrator, err := NewOrchestrator(&OrchestratorConfig{LLM: llmClient}, logger)
+	require.NoError(t, err)
+	require.NoError(t, orchestrator.RegisterInProcessMCP("echo", newEchoMCPServer()))
+
+	updateChan := make(chan OrchestrationUpdate, 100)
+	go orchestrator.ExecuteTask(context.Background(), &OrchestrationRequest{Query: "echo hi", Strategy: StrategyReAct}, updateChan)
+	models := map[string]string{}
+	for update := range updateChan {
+		if update.Type != UpdateTypeToken {
+			models[update.Type] = update.Model
+		}
+	}
+	assert.Equal(t, map[string]string{
+		UpdateTypeStepStarted: "",
+		UpdateTypeToolCall:    "backup-model",
+		UpdateTypeToolResult:  "backup-model",
+		UpdateTypeResult:      "backup-model",
+	}, models)
+}
+
+func TestHandleLLMHealth(t *testing.T) {
+	var primaryHealthy, backupHealthy atomic.Bool
+	var primaryHits, backupHits atomic.Int32
+	backupHealthy.Store(true)
+	primary := newModelServer(t, &primaryHealthy, &primaryHits, nil)
+	backup := newModelServer(t, &backupHealthy, &backupHits, nil)
+	fallback := newTestFallback([]*httptest.Server{primary, backup}, []string{"primary-model", "backup-model"}, []string{"", ""},
+		&CircuitBreakerPolicy{FailureThreshold: 1, Cooldown: time.Minute})
+	_, err := fallback.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	require.NoError(t, err)
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	orchestrator, err := NewOrchestrator(&OrchestratorConfig{LLM: fallback}, logger)
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(http.HandlerFunc(NewServer(orchestrator, logger).handleLLMHealth))
+	defer httpServer.Close()
+
+	resp, err := http.Get(httpServer.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var health []map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	require.Len(t, health, 2)
+	assert.Equal(t, "primary-model", health[0]["name"])
+	assert.Equal(t, CircuitOpen, health[0]["state"])
+	assert.Contains(t, health[0], "open_until")
+	// A healthy provider reports no failure times at all.
+	assert.Equal(t, map[string]interface{}{"name": "backup-model", "state": CircuitClosed, "consecutive_failures": float64(0)}, health[1])
+
+	resp, err = http.Post(httpServer.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -0,0 +1,171 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// LLMProvider is a chat model backend. Requests and responses use the OpenAI chat completion
+// types found throughout the package; providers for other APIs translate to and from them.
+type LLMProvider interface {
+	// CallChatCompletion sends messages, offering tools, and returns the complete response.
+	CallChatCompletion(ctx context.Context, messages []Message, tools []Tool) (*ChatCompletionResponse, error)
+	// StreamChatCompletionWithToolChoice streams the response, calling onDelta with every content
+	// fragment, and returns it assembled. toolChoice takes the OpenAI values: nil, "auto", "none",
+	// "required" or {"type": "function", "function": {"name": ...}}.
+	StreamChatCompletionWithToolChoice(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, onDelta func(string)) (*ChatCompletionResponse, error)
+}
+
+// LLM providers selectable with the LLM_PROVIDER environment variable.
+const (
+	LLMProviderOpenAI    = "openai" // Any OpenAI-compatible /v1/chat/completions server (default)
+	LLMProviderAnthropic = "anthropic"
+	LLMProviderOllama    = "ollama" // Ollama's native /api/chat
+	LLMProviderGemini    = "gemini"
+)
+
+// LLMEndpoint describes a fallback provider in LLM_FALLBACKS.
+type LLMEndpoint struct {
+	Provider  string `json:"provider,omitempty"`   // An LLM_PROVIDER value; empty is openai
+	ServerURL string `json:"server_url,omitempty"` // Required for openai; the others default to their public API
+	ModelName string `json:"model"`
+	APIKey    string `json:"api_key,omitempty"`
+
+	// Ollama settings of the fallback; LLM_OLLAMA_OPTIONS, LLM_OLLAMA_KEEP_ALIVE and
+	// LLM_OLLAMA_FORMAT only apply to the primary provider. Other providers reject them.
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Format    json.RawMessage        `json:"format,omitempty"` // "json", or a JSON schema
+}
+
+// NewLLMProviderFromEnv creates the provider named by LLM_PROVIDER, configured from
+// LLM_SERVER_URL, LLM_MODEL and LLM_TIMEOUT_SECONDS, and LLM_API_KEY for hosted APIs.
+// Ollama also takes LLM_OLLAMA_OPTIONS (a JSON object of model options such as num_ctx),
+// LLM_OLLAMA_KEEP_ALIVE and LLM_OLLAMA_FORMAT ("json" or a JSON schema). If LLM_FALLBACKS,
+// a JSON array of LLMEndpoint, is set, the provider is wrapped in an LLMFallback that fails
+// over to those providers in order.
+func NewLLMProviderFromEnv(logger *slog.Logger) (LLMProvider, error) {
+	primary, err := newLLMProviderFromEnv(logger)
+	if err != nil {
+		return nil, err
+	}
+	fallbacks := os.Getenv("LLM_FALLBACKS")
+	if fallbacks == "" {
+		return primary, nil
+	}
+	var endpoints []LLMEndpoint
+	if err := json.Unmarshal([]byte(fallbacks), &endpoints); err != nil {
+		return nil, fmt.Errorf("invalid LLM_FALLBACKS: %w", err)
+	}
+	providers := []LLMFallbackProvider{{Name: GetLLMModelName(), Provider: primary}}
+	for _, endpoint := range endpoints {
+		provider, err := newLLMProviderForEndpoint(endpoint, logger)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_FALLBACKS: %w", err)
+		}
+		providers = append(providers, LLMFallbackProvider{Name: endpoint.ModelName, Provider: provider})
+	}
+	return NewLLMFallback(providers, nil, logger), nil
+}
+
+// newLLMProviderForEndpoint creates the fallback provider described by endpoint.
+func newLLMProviderForEndpoint(endpoint LLMEndpoint, logger *slog.Logger) (LLMProvider, error) {
+	if endpoint.ModelName == "" {
+		return nil, fmt.Errorf("fallback model cannot be empty")
+	}
+	if endpoint.Provider != LLMProviderOllama && (endpoint.Options != nil || endpoint.KeepAlive != "" || endpoint.Format != nil) {
+		return nil, fmt.Errorf("fallback %q: options, keep_alive and format only apply to the %s provider", endpoint.ModelName, LLMProviderOllama)
+	}
+	switch endpoint.Provider {
+	case "", LLMProviderOpenAI:
+		if endpoint.ServerURL == "" {
+			return nil, fmt.Errorf("fallback %q needs a server_url", endpoint.ModelName)
+		}
+		return NewLLMClient(&LLMClientConfig{ServerURL: endpoint.ServerURL, ModelName: endpoint.ModelName, APIKey: endpoint.APIKey, Timeout: GetLLMTimeout()}, logger), nil
+	case LLMProviderAnthropic:
+		return NewAnthropicClient(&AnthropicClientConfig{ServerURL: endpoint.ServerURL, APIKey: endpoint.APIKey, ModelName: endpoint.ModelName, Timeout: GetLLMTimeout()}, logger), nil
+	case LLMProviderGemini:
+		return NewGeminiClient(&GeminiClientConfig{BaseURL: endpoint.ServerURL, APIKey: endpoint.APIKey, ModelName: endpoint.ModelName, Timeout: GetLLMTimeout()}, logger), nil
+	case LLMProviderOllama:
+		config := &OllamaClientConfig{ServerURL: endpoint.ServerURL, ModelName: endpoint.ModelName, Timeout: GetLLMTimeout(), Options: endpoint.Options, KeepAlive: endpoint.KeepAlive}
+		if endpoint.Format != nil {
+			var format string
+			if err := json.Unmarshal(endpoint.Format, &format); err == nil {
+				config.Format = format
+			} else {
+				config.Format = endpoint.Format // A JSON schema
+			}
+		}
+		return NewOllamaClient(config, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", endpoint.Provider)
+	}
+}
+
+// newLLMProviderFromEnv creates the primary provider for NewLLMProviderFromEnv.
+func newLLMProviderFromEnv(logger *slog.Logger) (LLMProvider, error) {
+	switch provider := os.Getenv("LLM_PROVIDER"); provider {
+	case "", LLMProviderOpenAI:
+		return NewLLMClient(&LLMClientConfig{
+			ServerURL: GetLLMServerURL(),
+			ModelName: GetLLMModelName(),
+			APIKey:    os.Getenv("LLM_API_KEY"),
+			Timeout:   GetLLMTimeout(),
+		}, logger), nil
+	case LLMProviderAnthropic:
+		modelName, err := requiredLLMModelName(provider)
+		if err != nil {
+			return nil, err
+		}
+		return NewAnthropicClient(&AnthropicClientConfig{
+			ServerURL: os.Getenv("LLM_SERVER_URL"),
+			APIKey:    os.Getenv("LLM_API_KEY"),
+			ModelName: modelName,
+			Timeout:   GetLLMTimeout(),
+		}, logger), nil
+	case LLMProviderGemini:
+		modelName, err := requiredLLMModelName(provider)
+		if err != nil {
+			return nil, err
+		}
+		return NewGeminiClient(&GeminiClientConfig{
+			BaseURL:   os.Getenv("LLM_SERVER_URL"),
+			APIKey:    os.Getenv("LLM_API_KEY"),
+			ModelName: modelName,
+			Timeout:   GetLLMTimeout(),
+		}, logger), nil
+	case LLMProviderOllama:
+		config := &OllamaClientConfig{
+			ServerURL: os.Getenv("LLM_SERVER_URL"),
+			ModelName: GetLLMModelName(),
+			Timeout:   GetLLMTimeout(),
+			KeepAlive: os.Getenv("LLM_OLLAMA_KEEP_ALIVE"),
+		}
+		if options := os.Getenv("LLM_OLLAMA_OPTIONS"); options != "" {
+			if err := json.Unmarshal([]byte(options), &config.Options); err != nil {
+				return nil, fmt.Errorf("invalid LLM_OLLAMA_OPTIONS: %w", err)
+			}
+		}
+		if format := os.Getenv("LLM_OLLAMA_FORMAT"); format != "" {
+			config.Format = format
+			if json.Valid([]byte(format)) {
+				config.Format = json.RawMessage(format) // A JSON schema
+			}
+		}
+		return NewOllamaClient(config, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", provider)
+	}
+}
+
+// requiredLLMModelName returns LLM_MODEL for hosted providers, which have no sensible default model.
+func requiredLLMModelName(provider string) (string, error) {
+	modelName := os.Getenv("LLM_MODEL")
+	if modelName == "" {
+		return "", fmt.Errorf("LLM_MODEL must be set for the %s provider", provider)
+	}
+	return modelName, nil
+}
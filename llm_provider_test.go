@@ -0,0 +1,89 @@
+package go_as
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLLMProviderFromEnv(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	t.Setenv("LLM_PROVIDER", "")
+	t.Setenv("LLM_MODEL", "local-model")
+	t.Setenv("LLM_FALLBACKS", `[
+		{"server_url": "https://llm.example.com/v1/chat/completions", "model": "backup-model", "api_key": "secret"},
+		{"provider": "anthropic", "model": "hosted-model", "api_key": "secret"},
+		{"provider": "ollama", "model": "ollama-model", "options": {"num_ctx": 8192}, "keep_alive": "10m", "format": "json"},
+		{"provider": "ollama", "model": "schema-model", "format": {"type": "object"}}
+	]`)
+	provider, err := NewLLMProviderFromEnv(logger)
+	require.NoError(t, err)
+	require.IsType(t, &LLMFallback{}, provider)
+	fallback := provider.(*LLMFallback)
+	require.Len(t, fallback.providers, 5)
+	assert.Equal(t, "local-model", fallback.providers[0].Name)
+	assert.IsType(t, &LLMClient{}, fallback.providers[0].Provider)
+	assert.Equal(t, &LLMClientConfig{ServerURL: "https://llm.example.com/v1/chat/completions", ModelName: "backup-model", APIKey: "secret", Timeout: GetLLMTimeout()}, fallback.providers[1].Provider.(*LLMClient).config)
+	assert.Equal(t, "hosted-model", fallback.providers[2].Name)
+	assert.IsType(t, &AnthropicClient{}, fallback.providers[2].Provider)
+	ollamaConfig := fallback.providers[3].Provider.(*OllamaClient).config
+	assert.Equal(t, map[string]interface{}{"num_ctx": float64(8192)}, ollamaConfig.Options)
+	assert.Equal(t, "10m", ollamaConfig.KeepAlive)
+	assert.Equal(t, "json", ollamaConfig.Format)
+	assert.Equal(t, json.RawMessage(`{"type": "object"}`), fallback.providers[4].Provider.(*OllamaClient).config.Format)
+
+	t.Setenv("LLM_FALLBACKS", `{}`)
+	_, err = NewLLMProviderFromEnv(logger)
+	assert.ErrorContains(t, err, "invalid LLM_FALLBACKS")
+	t.Setenv("LLM_FALLBACKS", `[{"model": "backup-model"}]`)
+	_, err = NewLLMProviderFromEnv(logger)
+	assert.ErrorContains(t, err, "needs a server_url")
+	t.Setenv("LLM_FALLBACKS", `[{"server_url": "https://llm.example.com/v1/chat/completions", "model": "backup-model", "keep_alive": "10m"}]`)
+	_, err = NewLLMProviderFromEnv(logger)
+	assert.ErrorContains(t, err, "only apply to the ollama provider")
+	t.Setenv("LLM_FALLBACKS", "")
+
+	provider, err = NewLLMProviderFromEnv(logger)
+	require.NoError(t, err)
+	assert.IsType(t, &LLMClient{}, provider)
+
+	t.Setenv("LLM_PROVIDER", LLMProviderAnthropic)
+	t.Setenv("LLM_MODEL", "")
+	_, err = NewLLMProviderFromEnv(logger)
+	assert.ErrorContains(t, err, "LLM_MODEL must be set")
+
+	t.Setenv("LLM_MODEL", "test-model")
+	provider, err = NewLLMProviderFromEnv(logger)
+	require.NoError(t, err)
+	assert.IsType(t, &AnthropicClient{}, provider)
+
+	t.Setenv("LLM_PROVIDER", LLMProviderGemini)
+	provider, err = NewLLMProviderFromEnv(logger)
+	require.NoError(t, err)
+	assert.IsType(t, &GeminiClient{}, provider)
+
+	t.Setenv("LLM_PROVIDER", LLMProviderOllama)
+	t.Setenv("LLM_OLLAMA_OPTIONS", `{"num_ctx": 8192}`)
+	t.Setenv("LLM_OLLAMA_KEEP_ALIVE", "10m")
+	t.Setenv("LLM_OLLAMA_FORMAT", "json")
+	provider, err = NewLLMProviderFromEnv(logger)
+	require.NoError(t, err)
+	require.IsType(t, &OllamaClient{}, provider)
+	config := provider.(*OllamaClient).config
+	assert.Equal(t, map[string]interface{}{"num_ctx": float64(8192)}, config.Options)
+	assert.Equal(t, "10m", config.KeepAlive)
+	assert.Equal(t, "json", config.Format)
+
+	t.Setenv("LLM_OLLAMA_OPTIONS", `{"num_ctx": `)
+	_, err = NewLLMProviderFromEnv(logger)
+	assert.ErrorContains(t, err, "invalid LLM_OLLAMA_OPTIONS")
+
+	t.Setenv("LLM_PROVIDER", "unknown")
+	_, err = NewLLMProviderFromEnv(logger)
+	assert.ErrorContains(t, err, `unknown LLM provider "unknown"`)
+}
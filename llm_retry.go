@@ -0,0 +1,127 @@
+package go_as
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// LLMStatusError is returned when an LLM API answers with a status other than 200 OK.
+type LLMStatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // Delay asked for with a Retry-After header; zero if absent
+}
+
+func (e *LLMStatusError) Error() string {
+	return fmt.Sprintf("non-OK status: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// llmRetryPolicy returns policy, or DefaultLLMRetryPolicy if it is nil.
+func llmRetryPolicy(policy *LLMRetryPolicy) LLMRetryPolicy {
+	if policy == nil {
+		return DefaultLLMRetryPolicy()
+	}
+	return *policy
+}
+
+// retryable reports whether err, returned by an attempt of an LLM request, is worth retrying:
+// a transport error or a retryable status. Errors caused by ctx ending are not.
+func (p LLMRetryPolicy) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *LLMStatusError
+	if errors.As(err, &statusErr) {
+		codes := p.RetryableStatusCodes
+		if codes == nil {
+			codes = DefaultRetryableStatusCodes
+		}
+		return slices.Contains(codes, statusErr.StatusCode)
+	}
+	return true // Connection refused or reset, timeouts and the like
+}
+
+// backoff returns the jittered delay before retry number retry (1-based).
+func (p LLMRetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// doLLMRequest sends the request built by newRequest, which is called again for every attempt,
+// retrying transient failures according to policy. It returns the response once the API
+// answers 200 OK; any other final status is returned as an *LLMStatusError. Only the request
+// is retried: a response whose stream fails after it has started is not.
+func doLLMRequest(ctx context.Context, client *http.Client, policy LLMRetryPolicy, logger *slog.Logger, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("could not create request: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			err = fmt.Errorf("error sending request: %w", err)
+		} else if resp.StatusCode != http.StatusOK {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			err = &LLMStatusError{StatusCode: resp.StatusCode, Body: string(respBody), RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		} else {
+			return resp, nil
+		}
+
+		if attempt >= policy.MaxAttempts || !policy.retryable(ctx, err) {
+			return nil, err
+		}
+		delay := policy.backoff(attempt)
+		var statusErr *LLMStatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if policy.MaxRetryAfter > 0 && statusErr.RetryAfter > policy.MaxRetryAfter {
+				return nil, err
+			}
+			delay = statusErr.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err // The retry could not finish in time
+		}
+
+		logger.Warn("LLM request failed, retrying.", "attempt", attempt, "delay", delay, "error", err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseRetryAfter returns the delay asked for by a Retry-After header, given either in
+// seconds or as an HTTP date, or zero if the header is absent or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
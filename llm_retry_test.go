@@ -0,0 +1,169 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMClientRetries(t *testing.T) {
+	fastRetries := LLMRetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+	tests := []struct {
+		name         string
+		policy       LLMRetryPolicy
+		failures     []int // Status of each failing attempt before a 200 OK; 0 drops the connection
+		retryAfter   string
+		wantAttempts int32
+		wantStatus   int // Status of the expected *LLMStatusError; 0 if the call succeeds
+		wantMinDelay time.Duration
+	}{
+		{name: "succeeds after transient failures", policy: fastRetries, failures: []int{503, 502}, wantAttempts: 3},
+		{name: "retries dropped connections", policy: fastRetries, failures: []int{0}, wantAttempts: 2},
+		{name: "does not retry client errors", policy: fastRetries, failures: []int{400}, wantAttempts: 1, wantStatus: 400},
+		{name: "gives up after max attempts", policy: fastRetries, failures: []int{500, 500, 500}, wantAttempts: 3, wantStatus: 500},
+		{name: "honours Retry-After", policy: fastRetries, failures: []int{429}, retryAfter: "1", wantAttempts: 2, wantMinDelay: time.Second},
+		{
+			name:         "waits for a Retry-After longer than the max backoff",
+			policy:       LLMRetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond},
+			failures:     []int{429},
+			retryAfter:   "1",
+			wantAttempts: 2,
+			wantMinDelay: time.Second,
+		},
+		{
+			name:         "gives up if Retry-After exceeds the max Retry-After",
+			policy:       LLMRetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxRetryAfter: 100 * time.Millisecond},
+			failures:     []int{429},
+			retryAfter:   "60",
+			wantAttempts: 1,
+			wantStatus:   429,
+		},
+		{
+			name:         "custom retryable statuses",
+			policy:       LLMRetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, RetryableStatusCodes: []int{409}},
+			failures:     []int{409, 503},
+			wantAttempts: 2,
+			wantStatus:   503,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1))
+				if n <= len(tt.failures) {
+					status := tt.failures[n-1]
+					if status == 0 {
+						conn, _, err := w.(http.Hijacker).Hijack()
+						require.NoError(t, err)
+						conn.Close()
+						return
+					}
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					http.Error(w, "failed", status)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: Message{Role: "assistant", Content: "ok"}, FinishReason: "stop"}}})
+			}))
+			defer mockLLMServer.Close()
+
+			logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+			policy := tt.policy
+			llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second, Retry: &policy}, logger)
+
+			start := time.Now()
+			response, err := llmClient.CallChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+			assert.Equal(t, tt.wantAttempts, attempts.Load())
+			assert.GreaterOrEqual(t, time.Since(start), tt.wantMinDelay)
+			if tt.wantStatus != 0 {
+				var statusErr *LLMStatusError
+				require.ErrorAs(t, err, &statusErr)
+				assert.Equal(t, tt.wantStatus, statusErr.StatusCode)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "ok", response.Choices[0].Message.Content)
+		})
+	}
+}
+
+func TestLLMClientRetryStopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts atomic.Int32
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		time.AfterFunc(50*time.Millisecond, cancel) // Cancel while the client waits to retry
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer mockLLMServer.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	policy := LLMRetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Second}
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second, Retry: &policy}, logger)
+
+	start := time.Now()
+	_, err := llmClient.CallChatCompletion(ctx, []Message{{Role: "user", Content: "hi"}}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestLLMClientRetryAfterBeyondDeadline(t *testing.T) {
+	var attempts atomic.Int32
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer mockLLMServer.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	policy := LLMRetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second, Retry: &policy}, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := llmClient.CallChatCompletion(ctx, []Message{{Role: "user", Content: "hi"}}, nil)
+	var statusErr *LLMStatusError
+	require.ErrorAs(t, err, &statusErr, "a Retry-After past the deadline should fail at once")
+	assert.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestLLMRetryPolicyBackoff(t *testing.T) {
+	policy := LLMRetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.2}
+	for retry, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		for i := 0; i < 20; i++ {
+			delay := policy.backoff(retry)
+			assert.GreaterOrEqual(t, delay, time.Duration(float64(want)*0.8), "retry %d", retry)
+			assert.LessOrEqual(t, delay, time.Duration(float64(want)*1.2), "retry %d", retry)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.Equal(t, 7*time.Second, parseRetryAfter(strconv.Itoa(7)))
+
+	delay := parseRetryAfter(time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, float64(30*time.Second), float64(delay), float64(2*time.Second))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)))
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	mcpclient "github.com/mark3labs/mcp-go/client"
+	mcptransport "github.com/mark3labs/mcp-go/client/transport"
 	mcpcore "github.com/mark3labs/mcp-go/mcp"
 )
 
@@ -20,32 +21,78 @@ type AgentCommand struct {
 	Args       interface{}
 }
 
-// MCPClient manages a single connection to an MCP agent via stdin/stdout.
+// MCPClient manages a single connection to an MCP agent over stdio, SSE, streamable HTTP or in-process.
 type MCPClient struct {
-	alias        string
-	client       *mcpclient.Client
-	cmd          *exec.Cmd
-	logger       *slog.Logger
-	mu           sync.Mutex
-	callToolFunc func(ctx context.Context, toolName string, args interface{}) (*mcpcore.CallToolResult, error)
+	alias  string
+	config *MCPConfig
+	client *mcpclient.Client
+	cmd    *exec.Cmd
+	logger *slog.Logger
+	mu     sync.Mutex // Guards client, state and draining
+
+	state          MCPClientState
+	draining       bool // Set by Shutdown; new calls are rejected
+	onToolsChanged func()
+	inflight       sync.WaitGroup // Tool calls currently using the connection
+	restartCh      chan struct{}
+	done           chan struct{}
+	closeOnce      sync.Once
 }
 
 // NewMCPClient creates a new MCPClient and starts the agent process.
 func NewMCPClient(alias string, command string, args []string, logger *slog.Logger) (*MCPClient, error) {
-	if command == "" {
-		return nil, fmt.Errorf("command cannot be empty for MCP client %s", alias)
+	return NewMCPClientWithConfig(&MCPConfig{
+		Alias:     alias,
+		Transport: MCPTransportStdio,
+		Command:   command,
+		Args:      args,
+	}, logger)
+}
+
+// NewMCPClientWithConfig creates a new MCPClient using the transport selected in config
+// and performs the MCP initialization handshake. Stdio agents are supervised and
+// restarted according to config.Restart if their process dies.
+func NewMCPClientWithConfig(config *MCPConfig, logger *slog.Logger) (*MCPClient, error) {
+	client := &MCPClient{
+		alias:     config.Alias,
+		config:    config,
+		cmd:       nil, // cmd is managed by transport, so we don't need it here
+		logger:    logger,
+		state:     MCPStateReady,
+		restartCh: make(chan struct{}, 1),
+		done:      make(chan struct{}),
 	}
 
-	mcpClient, err := mcpclient.NewStdioMCPClient(command, nil, args...)
+	mcpClient, err := connectMCP(config, client.handleNotification)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdio MCP client: %w", err)
+		return nil, err
 	}
+	client.client = mcpClient
 
-	client := &MCPClient{
-		alias:  alias,
-		cmd:    nil, // cmd is managed by transport, so we don't need it here
-		client: mcpClient,
-		logger: logger,
+	logger.Info("MCP client connected and initialized", "alias", config.Alias, "transport", transportName(config.Transport))
+
+	if policy := client.restartPolicy(); !policy.Disabled && transportName(config.Transport) == string(MCPTransportStdio) {
+		go client.supervise(policy)
+	}
+
+	return client, nil
+}
+
+// connectMCP creates and starts the underlying mcp-go client and runs the initialization handshake.
+// onNotification is registered before the transport starts so no server notification is missed.
+func connectMCP(config *MCPConfig, onNotification func(mcpcore.JSONRPCNotification)) (*mcpclient.Client, error) {
+	mcpClient, err := newTransportClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if onNotification != nil {
+		mcpClient.OnNotification(onNotification)
+	}
+
+	// The transport (stdio process, SSE stream) outlives the start call, so it must not be bound to a short-lived context.
+	if err := mcpClient.Start(context.Background()); err != nil {
+		mcpClient.Close()
+		return nil, fmt.Errorf("failed to start %s MCP client: %w", transportName(config.Transport), err)
 	}
 
 	// Initialize the MCP client
@@ -59,34 +106,173 @@ func NewMCPClient(alias string, command string, args []string, logger *slog.Logg
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // Add a timeout for initialization
 	defer cancel()
 
-	_, err = mcpClient.Initialize(ctx, initRequest)
-	if err != nil {
-		client.Close() // Close the client if initialization fails
+	if _, err := mcpClient.Initialize(ctx, initRequest); err != nil {
+		mcpClient.Close() // Close the client if initialization fails
 		return nil, fmt.Errorf("failed to initialize MCP client: %w", err)
 	}
 
-	logger.Info("MCP client connected and initialized", "alias", alias, "command", command)
+	return mcpClient, nil
+}
+
+// newTransportClient builds the underlying mcp-go client for the configured transport without starting it.
+// Every transport is wrapped so that abandoned requests are cancelled on the server.
+func newTransportClient(config *MCPConfig) (*mcpclient.Client, error) {
+	var transport mcptransport.Interface
+	switch config.Transport {
+	case "", MCPTransportStdio:
+		if config.Command == "" {
+			return nil, fmt.Errorf("command cannot be empty for MCP client %s", config.Alias)
+		}
+		transport = mcptransport.NewStdio(config.Command, config.Env, config.Args...)
+
+	case MCPTransportSSE:
+		if config.URL == "" {
+			return nil, fmt.Errorf("url cannot be empty for SSE MCP client %s", config.Alias)
+		}
+		sse, err := mcptransport.NewSSE(config.URL, mcptransport.WithHeaders(config.Headers))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SSE MCP client: %w", err)
+		}
+		transport = sse
+
+	case MCPTransportStreamableHTTP:
+		if config.URL == "" {
+			return nil, fmt.Errorf("url cannot be empty for streamable HTTP MCP client %s", config.Alias)
+		}
+		// Continuous listening opens the GET stream the server uses for notifications such as tools/list_changed.
+		streamable, err := mcptransport.NewStreamableHTTP(config.URL, mcptransport.WithHTTPHeaders(config.Headers), mcptransport.WithContinuousListening())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create streamable HTTP MCP client: %w", err)
+		}
+		transport = streamable
+
+	case MCPTransportInProcess:
+		if config.Server == nil {
+			return nil, fmt.Errorf("server cannot be nil for in-process MCP client %s", config.Alias)
+		}
+		transport = mcptransport.NewInProcessTransport(config.Server)
+
+	default:
+		return nil, fmt.Errorf("unsupported MCP transport %q for MCP client %s", config.Transport, config.Alias)
+	}
+
+	return mcpclient.NewClient(&cancellingTransport{Interface: transport}), nil
+}
 
-	return client, nil
+// OnToolsChanged registers a callback invoked when the agent's tool list may have changed:
+// on a notifications/tools/list_changed from the server and after a restart.
+func (c *MCPClient) OnToolsChanged(handler func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onToolsChanged = handler
+}
+
+// handleNotification dispatches server notifications received by the transport.
+func (c *MCPClient) handleNotification(notification mcpcore.JSONRPCNotification) {
+	if notification.Method == mcpcore.MethodNotificationToolsListChanged {
+		c.logger.Info("MCP client received tools/list_changed", "alias", c.alias)
+		c.notifyToolsChanged()
+	}
+}
+
+// notifyToolsChanged runs the OnToolsChanged callback off the transport's read loop,
+// since the callback typically issues a tools/list request on the same connection.
+func (c *MCPClient) notifyToolsChanged() {
+	c.mu.Lock()
+	handler := c.onToolsChanged
+	c.mu.Unlock()
+	if handler != nil {
+		go handler()
+	}
+}
+
+// transportName returns the effective transport name for logging.
+func transportName(transport MCPTransport) string {
+	if transport == "" {
+		return string(MCPTransportStdio)
+	}
+	return string(transport)
 }
 
 // Close closes the client connection and stops the agent process.
 func (c *MCPClient) Close() error {
-	if c.client != nil {
-		c.client.Close()
+	if c.done != nil {
+		c.closeOnce.Do(func() { close(c.done) })
+	}
+	c.mu.Lock()
+	client := c.client
+	c.client = nil
+	c.mu.Unlock()
+	if client != nil {
+		client.Close()
 	}
 	// cmd is managed by transport, so no need to kill it here
 	return nil
 }
 
-// CallTool calls a tool on the MCP agent.
-func (c *MCPClient) CallTool(ctx context.Context, toolName string, args interface{}) (*mcpcore.CallToolResult, error) {
-	if c.callToolFunc != nil {
-		return c.callToolFunc(ctx, toolName, args)
+// Shutdown stops accepting new calls, waits for in-flight tool calls to finish
+// (or ctx to expire) and then closes the connection.
+func (c *MCPClient) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("MCP agent %s closed with calls still in flight: %w", c.alias, ctx.Err())
+	}
+	c.Close()
+	return err
+}
+
+// current returns the live mcp-go client, or an error if the agent is not ready.
+func (c *MCPClient) current() (*mcpclient.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.currentLocked()
+}
+
+func (c *MCPClient) currentLocked() (*mcpclient.Client, error) {
+	if c.draining {
+		return nil, fmt.Errorf("MCP agent %s is shutting down", c.alias)
+	}
+	if c.state != "" && c.state != MCPStateReady {
+		return nil, fmt.Errorf("MCP agent %s is %s", c.alias, c.state)
+	}
+	if c.client == nil {
+		return nil, fmt.Errorf("MCP agent %s is closed", c.alias)
 	}
+	return c.client, nil
+}
 
+// acquire returns the live mcp-go client and registers an in-flight call that
+// Shutdown will wait for. Callers must call c.inflight.Done when finished.
+func (c *MCPClient) acquire() (*mcpclient.Client, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	client, err := c.currentLocked()
+	if err != nil {
+		return nil, err
+	}
+	c.inflight.Add(1)
+	return client, nil
+}
+
+// CallTool calls a tool on the MCP agent.
+func (c *MCPClient) CallTool(ctx context.Context, toolName string, args interface{}) (*mcpcore.CallToolResult, error) {
+	client, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer c.inflight.Done()
 
 	// Marshal arguments to JSON
 	argsBytes, err := json.Marshal(args)
@@ -94,8 +280,9 @@ func (c *MCPClient) CallTool(ctx context.Context, toolName string, args interfac
 		return nil, fmt.Errorf("failed to marshal tool arguments: %w", err)
 	}
 
-	result, err := c.client.CallTool(ctx, mcpcore.CallToolRequest{Params: mcpcore.CallToolParams{Name: toolName, Arguments: json.RawMessage(argsBytes)}})
+	result, err := client.CallTool(ctx, mcpcore.CallToolRequest{Params: mcpcore.CallToolParams{Name: toolName, Arguments: json.RawMessage(argsBytes)}})
 	if err != nil {
+		c.checkTransportError(client, err)
 		return nil, fmt.Errorf("failed to call tool: %w", err)
 	}
 
@@ -104,11 +291,15 @@ func (c *MCPClient) CallTool(ctx context.Context, toolName string, args interfac
 
 // GetTools makes an RPC call to the MCP agent to discover its supported tools.
 func (c *MCPClient) GetTools(ctx context.Context) ([]mcpcore.Tool, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	client, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer c.inflight.Done()
 
-	tools, err := c.client.ListTools(ctx, mcpcore.ListToolsRequest{})
+	tools, err := client.ListTools(ctx, mcpcore.ListToolsRequest{})
 	if err != nil {
+		c.checkTransportError(client, err)
 		return nil, fmt.Errorf("failed to list tools: %w", err)
 	}
 
@@ -0,0 +1,290 @@
+package go_as
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mcpcore "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// TestMain lets the test binary double as a stdio MCP agent for the supervision tests.
+func TestMain(m *testing.M) {
+	if os.Getenv("GO_AS_TEST_STDIO_MCP") == "1" {
+		s := newEchoMCPServer()
+		s.AddTool(mcpcore.NewTool("crash"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+			os.Exit(1)
+			return nil, nil
+		})
+		if err := mcpserver.ServeStdio(s); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// newEchoMCPServer builds an mcp-go server exposing a single "echo" tool.
+func newEchoMCPServer() *mcpserver.MCPServer {
+	s := mcpserver.NewMCPServer("echo-server", "1.0.0", mcpserver.WithToolCapabilities(true))
+	s.AddTool(
+		mcpcore.NewTool("echo",
+			mcpcore.WithDescription("Echoes the given text."),
+			mcpcore.WithString("text", mcpcore.Required()),
+		),
+		func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+			text, err := request.RequireString("text")
+			if err != nil {
+				return mcpcore.NewToolResultError(err.Error()), nil
+			}
+			return mcpcore.NewToolResultText(text), nil
+		},
+	)
+	return s
+}
+
+func TestOrchestratorManageMCPRemoteTransports(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	sseServer := mcpserver.NewTestServer(newEchoMCPServer())
+	defer sseServer.Close()
+	httpServer := mcpserver.NewTestStreamableHTTPServer(newEchoMCPServer())
+	defer httpServer.Close()
+
+	testCases := []struct {
+		name   string
+		config *MCPConfig
+	}{
+		{
+			name: "SSE",
+			config: &MCPConfig{
+				Alias:     "sse",
+				Transport: MCPTransportSSE,
+				URL:       sseServer.URL + "/sse",
+				Headers:   map[string]string{"X-Test": "1"},
+			},
+		},
+		{
+			name: "Streamable HTTP",
+			config: &MCPConfig{
+				Alias:     "http",
+				Transport: MCPTransportStreamableHTTP,
+				URL:       httpServer.URL + "/mcp",
+				Headers:   map[string]string{"X-Test": "1"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			orchestrator, err := NewOrchestrator(&OrchestratorConfig{}, logger)
+			require.NoError(t, err)
+
+			require.NoError(t, orchestrator.ManageMCP(tc.config))
+			client := orchestrator.mcpClients[tc.config.Alias]
+			require.NotNil(t, client)
+			defer client.Close()
+
+			tools, err := client.GetTools(context.Background())
+			require.NoError(t, err)
+			require.Len(t, tools, 1)
+			assert.Equal(t, "echo", tools[0].Name)
+
+			result, err := client.CallTool(context.Background(), "echo", map[string]interface{}{"text": "hello"})
+			require.NoError(t, err)
+			text, err := NewSynthesizer().Synthesize(result)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", text)
+		})
+	}
+}
+
+func TestNewMCPClientWithConfigValidation(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	_, err := NewMCPClientWithConfig(&MCPConfig{Alias: "empty"}, logger)
+	assert.ErrorContains(t, err, "command cannot be empty")
+
+	_, err = NewMCPClientWithConfig(&MCPConfig{Alias: "remote", Transport: MCPTransportSSE}, logger)
+	assert.ErrorContains(t, err, "url cannot be empty")
+
+	_, err = NewMCPClientWithConfig(&MCPConfig{Alias: "bogus", Transport: "carrier-pigeon"}, logger)
+	assert.ErrorContains(t, err, "unsupported MCP transport")
+}
+
+func TestOrchestratorRegisterMCPTools(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	orchestrator, err := NewOrchestrator(&OrchestratorConfig{}, logger)
+	require.NoError(t, err)
+
+	err = orchestrator.RegisterMCPTools("math", mcpserver.ServerTool{
+		Tool: mcpcore.NewTool("double", mcpcore.WithNumber("n", mcpcore.Required())),
+		Handler: func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+			n, err := request.RequireFloat("n")
+			if err != nil {
+				return mcpcore.NewToolResultError(err.Error()), nil
+			}
+			return mcpcore.NewToolResultText(fmt.Sprintf("%g", n*2)), nil
+		},
+	})
+	require.NoError(t, err)
+
+	agent := NewAgent(orchestrator.llmClient, orchestrator.mcpClients, logger, nil)
+	result, err := agent.executeToolCall(context.Background(), &ToolCall{
+		Type:     "function",
+		Function: FunctionCall{Name: "math.double", Arguments: `{"n": 21}`},
+	})
+	require.NoError(t, err)
+	text, err := NewSynthesizer().Synthesize(result)
+	require.NoError(t, err)
+	assert.Equal(t, "42", text)
+
+	assert.ErrorContains(t, orchestrator.RegisterInProcessMCP("nil", nil), "server cannot be nil")
+}
+
+func TestMCPClientRestartsCrashedStdioAgent(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	client, err := NewMCPClientWithConfig(&MCPConfig{
+		Alias:   "stdio",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^$"},
+		Env:     []string{"GO_AS_TEST_STDIO_MCP=1"},
+		Restart: &RestartPolicy{
+			MaxAttempts:         5,
+			InitialBackoff:      10 * time.Millisecond,
+			MaxBackoff:          100 * time.Millisecond,
+			HealthCheckInterval: 50 * time.Millisecond,
+		},
+	}, logger)
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, MCPStateReady, client.State())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = client.CallTool(ctx, "crash", map[string]interface{}{})
+	require.Error(t, err)
+
+	require.Eventually(t, func() bool {
+		result, err := client.CallTool(context.Background(), "echo", map[string]interface{}{"text": "back"})
+		return err == nil && !result.IsError
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, MCPStateReady, client.State())
+}
+
+func TestMCPClientPartialRestartPolicy(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	client, err := NewMCPClientWithConfig(&MCPConfig{
+		Alias:   "stdio",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^$"},
+		Env:     []string{"GO_AS_TEST_STDIO_MCP=1"},
+		Restart: &RestartPolicy{MaxAttempts: 3},
+	}, logger)
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, MCPStateReady, client.State())
+
+	defaults := DefaultRestartPolicy()
+	assert.Equal(t, RestartPolicy{
+		MaxAttempts:         3,
+		InitialBackoff:      defaults.InitialBackoff,
+		MaxBackoff:          defaults.MaxBackoff,
+		HealthCheckInterval: defaults.HealthCheckInterval,
+	}, client.restartPolicy())
+}
+
+func TestOrchestratorRemoveReplaceListMCPs(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	orchestrator, err := NewOrchestrator(&OrchestratorConfig{}, logger)
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowServer := mcpserver.NewMCPServer("slow", "1.0.0")
+	slowServer.AddTool(mcpcore.NewTool("wait"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		close(started)
+		<-release
+		return mcpcore.NewToolResultText("done"), nil
+	})
+
+	require.NoError(t, orchestrator.RegisterInProcessMCP("slow", slowServer))
+	require.NoError(t, orchestrator.RegisterInProcessMCP("echo", newEchoMCPServer()))
+	assert.ErrorContains(t, orchestrator.RegisterInProcessMCP("echo", newEchoMCPServer()), "already managed")
+
+	assert.Equal(t, []MCPInfo{
+		{Alias: "echo", Transport: MCPTransportInProcess, State: MCPStateReady},
+		{Alias: "slow", Transport: MCPTransportInProcess, State: MCPStateReady},
+	}, orchestrator.ListMCPs())
+
+	// Replacing keeps the alias registered and points it at the new server.
+	require.NoError(t, orchestrator.ReplaceMCP(&MCPConfig{Alias: "echo", Transport: MCPTransportInProcess, Server: newEchoMCPServer()}))
+	assert.Len(t, orchestrator.ListMCPs(), 2)
+
+	// Removing waits for the in-flight call before closing the client.
+	clients, _ := orchestrator.snapshot()
+	slowClient := clients["slow"]
+	callDone := make(chan error, 1)
+	go func() {
+		_, err := slowClient.CallTool(context.Background(), "wait", map[string]interface{}{})
+		callDone <- err
+	}()
+	<-started
+
+	removeDone := make(chan error, 1)
+	go func() { removeDone <- orchestrator.RemoveMCP("slow") }()
+
+	select {
+	case <-removeDone:
+		t.Fatal("RemoveMCP returned while a tool call was still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err = slowClient.CallTool(context.Background(), "wait", map[string]interface{}{})
+	assert.ErrorContains(t, err, "shutting down")
+
+	close(release)
+	require.NoError(t, <-callDone)
+	require.NoError(t, <-removeDone)
+
+	_, ok := orchestrator.MCPState("slow")
+	assert.False(t, ok)
+	assert.ErrorContains(t, orchestrator.RemoveMCP("slow"), "not managed")
+}
+
+func TestMCPClientSendsCancelledNotification(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	cancelled := make(chan mcpcore.JSONRPCNotification, 1)
+	s := mcpserver.NewMCPServer("slow", "1.0.0")
+	s.AddNotificationHandler(MCPMethodNotificationCancelled, func(ctx context.Context, notification mcpcore.JSONRPCNotification) {
+		cancelled <- notification
+	})
+	s.AddTool(mcpcore.NewTool("block"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	client, err := NewMCPClientWithConfig(&MCPConfig{Alias: "slow", Transport: MCPTransportInProcess, Server: s}, logger)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.CallTool(ctx, "block", map[string]interface{}{})
+	require.Error(t, err)
+
+	select {
+	case notification := <-cancelled:
+		assert.NotNil(t, notification.Params.AdditionalFields["requestId"])
+		assert.Equal(t, context.DeadlineExceeded.Error(), notification.Params.AdditionalFields["reason"])
+	case <-time.After(time.Second):
+		t.Fatal("server did not receive notifications/cancelled")
+	}
+}
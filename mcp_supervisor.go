@@ -0,0 +1,174 @@
+package go_as
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+)
+
+// MCPClientState describes the connection state of a managed MCP agent.
+type MCPClientState string
+
+const (
+	// MCPStateConnecting means the agent is being (re)started and is not accepting calls.
+	MCPStateConnecting MCPClientState = "connecting"
+	// MCPStateReady means the agent is initialized and accepting calls.
+	MCPStateReady MCPClientState = "ready"
+	// MCPStateFailed means the agent could not be restarted within its RestartPolicy.
+	MCPStateFailed MCPClientState = "failed"
+)
+
+// State reports the current connection state of the agent.
+func (c *MCPClient) State() MCPClientState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *MCPClient) setState(state MCPClientState) {
+	c.mu.Lock()
+	c.state = state
+	c.mu.Unlock()
+	c.logger.Info("MCP client state changed", "alias", c.alias, "state", state)
+}
+
+// restartPolicy returns the configured restart policy. Fields left at zero take their value
+// from DefaultRestartPolicy, so a partially filled policy is usable.
+func (c *MCPClient) restartPolicy() RestartPolicy {
+	policy := DefaultRestartPolicy()
+	if c.config == nil || c.config.Restart == nil {
+		return policy
+	}
+	configured := *c.config.Restart
+	if configured.MaxAttempts <= 0 {
+		configured.MaxAttempts = policy.MaxAttempts
+	}
+	if configured.InitialBackoff <= 0 {
+		configured.InitialBackoff = policy.InitialBackoff
+	}
+	if configured.MaxBackoff <= 0 {
+		configured.MaxBackoff = policy.MaxBackoff
+	}
+	if configured.HealthCheckInterval <= 0 {
+		configured.HealthCheckInterval = policy.HealthCheckInterval
+	}
+	return configured
+}
+
+// isTransportGone reports whether err shows that the pipes to the agent process are gone:
+// writing to a process that died fails with EPIPE, and to closed pipes with ErrClosed.
+// A dead agent that produces no such error is found by the health check instead.
+func isTransportGone(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, io.EOF)
+}
+
+// checkTransportError asks the supervisor for a restart if err indicates that the transport
+// behind client is gone. Errors from a connection that was already replaced are ignored.
+func (c *MCPClient) checkTransportError(client *mcpclient.Client, err error) {
+	if c.restartCh == nil || !isTransportGone(err) {
+		return
+	}
+	c.mu.Lock()
+	stale := c.client != client
+	c.mu.Unlock()
+	if stale {
+		return
+	}
+	select {
+	case c.restartCh <- struct{}{}:
+	default: // A restart is already pending
+	}
+}
+
+// supervise periodically pings the agent and restarts it when the transport fails.
+func (c *MCPClient) supervise(policy RestartPolicy) {
+	ticker := time.NewTicker(policy.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			err := c.ping(policy.HealthCheckInterval)
+			if err == nil {
+				continue
+			}
+			c.logger.Warn("MCP client health check failed", "alias", c.alias, "error", err)
+		case <-c.restartCh:
+			c.logger.Warn("MCP client transport failure reported", "alias", c.alias)
+		}
+
+		if !c.restart(policy) {
+			return
+		}
+	}
+}
+
+// ping checks that the agent still answers within the given timeout.
+func (c *MCPClient) ping(timeout time.Duration) error {
+	client, err := c.current()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return client.Ping(ctx)
+}
+
+// restart replaces the dead connection with a fresh one, backing off exponentially between attempts.
+// It returns false if the client was closed or every attempt failed.
+func (c *MCPClient) restart(policy RestartPolicy) bool {
+	c.mu.Lock()
+	old := c.client
+	c.client = nil
+	c.state = MCPStateConnecting
+	c.mu.Unlock()
+	c.logger.Info("MCP client state changed", "alias", c.alias, "state", MCPStateConnecting)
+	if old != nil {
+		old.Close()
+	}
+
+	backoff := policy.InitialBackoff
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(backoff):
+		}
+
+		mcpClient, err := connectMCP(c.config, c.handleNotification)
+		if err == nil {
+			c.mu.Lock()
+			select {
+			case <-c.done:
+				// Closed while reconnecting; discard the new connection.
+				c.mu.Unlock()
+				mcpClient.Close()
+				return false
+			default:
+			}
+			c.client = mcpClient
+			c.mu.Unlock()
+			c.setState(MCPStateReady)
+			c.logger.Info("MCP client restarted", "alias", c.alias, "attempt", attempt)
+			// A restarted process may expose a different tool set.
+			c.notifyToolsChanged()
+			return true
+		}
+
+		c.logger.Error("MCP client restart failed", "alias", c.alias, "attempt", attempt, "error", err)
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+
+	c.setState(MCPStateFailed)
+	return false
+}
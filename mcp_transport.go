@@ -0,0 +1,52 @@
+package go_as
+
+import (
+	"context"
+	"time"
+
+	mcptransport "github.com/mark3labs/mcp-go/client/transport"
+	mcpcore "github.com/mark3labs/mcp-go/mcp"
+)
+
+// MCPMethodNotificationCancelled is the MCP notification a client sends to tell the
+// server to stop working on a request it no longer waits for.
+const MCPMethodNotificationCancelled = "notifications/cancelled"
+
+// cancellingTransport wraps an mcp-go transport so that a request whose context ends
+// before the response arrives is followed by notifications/cancelled for its ID.
+type cancellingTransport struct {
+	mcptransport.Interface
+}
+
+// SendRequest sends the request and, if ctx is cancelled or times out while waiting,
+// notifies the server that the request was cancelled.
+func (t *cancellingTransport) SendRequest(ctx context.Context, request mcptransport.JSONRPCRequest) (*mcptransport.JSONRPCResponse, error) {
+	response, err := t.Interface.SendRequest(ctx, request)
+	// Synchronous transports (in-process) report the abandoned request as an error response
+	// rather than a transport error. The spec forbids cancelling the initialize request.
+	failed := err != nil || (response != nil && response.Error != nil)
+	if failed && ctx.Err() != nil && request.Method != string(mcpcore.MethodInitialize) {
+		t.sendCancelled(request.ID, ctx.Err())
+	}
+	return response, err
+}
+
+func (t *cancellingTransport) sendCancelled(id mcpcore.RequestId, reason error) {
+	notification := mcpcore.JSONRPCNotification{
+		JSONRPC: mcpcore.JSONRPC_VERSION,
+		Notification: mcpcore.Notification{
+			Method: MCPMethodNotificationCancelled,
+			Params: mcpcore.NotificationParams{
+				AdditionalFields: map[string]any{
+					"requestId": id,
+					"reason":    reason.Error(),
+				},
+			},
+		},
+	}
+
+	// The request context is already done, so the notification needs its own.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = t.Interface.SendNotification(ctx, notification) // Best effort; the server may already be gone
+}
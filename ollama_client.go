@@ -0,0 +1,225 @@
+package go_as
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DefaultOllamaURL is the chat endpoint of an Ollama server on its default port.
+const DefaultOllamaURL = "http://127.0.0.1:11434/api/chat"
+
+// OllamaClientConfig holds configuration for the Ollama client.
+type OllamaClientConfig struct {
+	ServerURL string // Chat endpoint; empty uses DefaultOllamaURL
+	ModelName string
+	Timeout   time.Duration
+	Retry     *LLMRetryPolicy // Retries of failed requests; nil uses DefaultLLMRetryPolicy
+	// Options are model parameters such as num_ctx, temperature or num_predict.
+	Options map[string]interface{}
+	// KeepAlive is how long the model stays loaded after a request, e.g. "10m"; empty uses
+	// the server's default.
+	KeepAlive string
+	// Format constrains the output: "json", or a JSON schema. nil leaves it free.
+	Format interface{}
+}
+
+// OllamaClient is an LLMProvider for Ollama's native /api/chat endpoint, which, unlike its
+// OpenAI-compatible layer, accepts model options, keep_alive and format.
+type OllamaClient struct {
+	config *OllamaClientConfig
+	logger *slog.Logger
+	client *http.Client
+}
+
+// NewOllamaClient creates a new OllamaClient.
+func NewOllamaClient(config *OllamaClientConfig, logger *slog.Logger) *OllamaClient {
+	return &OllamaClient{
+		config: config,
+		logger: logger,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// ollamaRequest is the request body of /api/chat.
+type ollamaRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []ollamaMessage        `json:"messages"`
+	Tools     []Tool                 `json:"tools,omitempty"`
+	Stream    bool                   `json:"stream"`
+	Format    interface{}            `json:"format,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // Set on "tool" messages
+}
+
+// ollamaToolCall is a tool call as Ollama sends it: without an ID, and with the arguments as
+// a JSON object rather than a string.
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaResponse is a response of /api/chat, or one line of a streamed response.
+type ollamaResponse struct {
+	Message    ollamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+	Error      string        `json:"error"`
+}
+
+// CallChatCompletion sends an /api/chat request and converts the response.
+func (c *OllamaClient) CallChatCompletion(ctx context.Context, messages []Message, tools []Tool) (*ChatCompletionResponse, error) {
+	return c.send(ctx, messages, tools, nil, false, nil)
+}
+
+// StreamChatCompletionWithToolChoice sends a streaming /api/chat request and assembles the
+// newline-delimited JSON chunks into a ChatCompletionResponse. onDelta is called with every
+// content fragment as it arrives. Ollama cannot be forced to call a tool, so toolChoice only
+// has an effect when it is "none", which withholds the tools.
+func (c *OllamaClient) StreamChatCompletionWithToolChoice(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, onDelta func(string)) (*ChatCompletionResponse, error) {
+	return c.send(ctx, messages, tools, toolChoice, true, onDelta)
+}
+
+func (c *OllamaClient) send(ctx context.Context, messages []Message, tools []Tool, toolChoice interface{}, stream bool, onDelta func(string)) (*ChatCompletionResponse, error) {
+	if toolChoice == "none" {
+		tools = nil
+	}
+	requestBody, err := json.Marshal(ollamaRequest{
+		Model:     c.config.ModelName,
+		Messages:  toOllamaMessages(messages),
+		Tools:     tools,
+		Stream:    stream,
+		Format:    c.config.Format,
+		Options:   c.config.Options,
+		KeepAlive: c.config.KeepAlive,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request body: %w", err)
+	}
+
+	serverURL := c.config.ServerURL
+	if serverURL == "" {
+		serverURL = DefaultOllamaURL
+	}
+	c.logger.Info("Sending Ollama request", "url", serverURL, "model", c.config.ModelName, "stream", stream)
+	resp, err := doLLMRequest(ctx, c.client, llmRetryPolicy(c.config.Retry), c.logger, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", serverURL, bytes.NewReader(requestBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// A non-streamed response is a single line of the same format, so one reader handles both.
+	var content bytes.Buffer
+	var toolCalls []ToolCall
+	var doneReason string
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var chunk ollamaResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				return nil, fmt.Errorf("could not decode response chunk: %w", err)
+			}
+			if chunk.Error != "" {
+				return nil, fmt.Errorf("ollama error: %s", chunk.Error)
+			}
+			if chunk.Message.Content != "" {
+				content.WriteString(chunk.Message.Content)
+				if onDelta != nil {
+					onDelta(chunk.Message.Content)
+				}
+			}
+			for _, toolCall := range chunk.Message.ToolCalls {
+				toolCalls = append(toolCalls, ToolCall{Type: "function", Function: FunctionCall{Name: toolCall.Function.Name, Arguments: ollamaArguments(toolCall.Function.Arguments)}})
+			}
+			if chunk.Done {
+				doneReason = chunk.DoneReason
+				break
+			}
+		}
+
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading stream: %w", readErr)
+		}
+	}
+
+	return &ChatCompletionResponse{
+		Choices: []ChatCompletionChoice{{
+			Message:      Message{Role: "assistant", Content: content.String(), ToolCalls: toolCalls},
+			FinishReason: ollamaFinishReason(doneReason, len(toolCalls) > 0),
+		}},
+		Model: c.config.ModelName,
+	}, nil
+}
+
+// toOllamaMessages converts the conversation to /api/chat messages. Tool call arguments are
+// sent as objects, and "tool" messages carry the name of the tool they answer.
+func toOllamaMessages(messages []Message) []ollamaMessage {
+	converted := make([]ollamaMessage, 0, len(messages))
+	for _, message := range messages {
+		ollamaMsg := ollamaMessage{Role: message.Role, Content: message.Content}
+		if message.Role == "tool" {
+			ollamaMsg.ToolName = message.Name
+		}
+		for _, toolCall := range message.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name = toolCall.Function.Name
+			call.Function.Arguments = json.RawMessage(toolCall.Function.Arguments)
+			if !json.Valid(call.Function.Arguments) {
+				call.Function.Arguments = json.RawMessage("{}")
+			}
+			ollamaMsg.ToolCalls = append(ollamaMsg.ToolCalls, call)
+		}
+		converted = append(converted, ollamaMsg)
+	}
+	return converted
+}
+
+// ollamaArguments returns tool call arguments as the JSON string the package uses. Ollama
+// sends an object, though some models produce a string holding the JSON.
+func ollamaArguments(arguments json.RawMessage) string {
+	var encoded string
+	if err := json.Unmarshal(arguments, &encoded); err == nil {
+		return encoded
+	}
+	if len(bytes.TrimSpace(arguments)) == 0 || string(arguments) == "null" {
+		return "{}"
+	}
+	return string(arguments)
+}
+
+// ollamaFinishReason maps done_reason to an OpenAI finish_reason.
+func ollamaFinishReason(doneReason string, hasToolCalls bool) string {
+	switch {
+	case hasToolCalls:
+		return "tool_calls"
+	case doneReason == "length":
+		return "length"
+	}
+	return "stop"
+}
@@ -0,0 +1,96 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOllamaClient(t *testing.T, config *OllamaClientConfig, handler http.HandlerFunc) *OllamaClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config.ServerURL = server.URL
+	config.ModelName = "test-model"
+	config.Timeout = 5 * time.Second
+	return NewOllamaClient(config, slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+}
+
+func TestOllamaClientCallChatCompletion(t *testing.T) {
+	config := &OllamaClientConfig{Options: map[string]interface{}{"num_ctx": 8192}, KeepAlive: "10m", Format: "json"}
+	client := newTestOllamaClient(t, config, func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "test-model", req["model"])
+		assert.Equal(t, false, req["stream"])
+		assert.Equal(t, map[string]interface{}{"num_ctx": float64(8192)}, req["options"])
+		assert.Equal(t, "10m", req["keep_alive"])
+		assert.Equal(t, "json", req["format"])
+
+		messages := req["messages"].([]interface{})
+		require.Len(t, messages, 3)
+		assistant := messages[1].(map[string]interface{})
+		assert.Equal(t, []interface{}{map[string]interface{}{"function": map[string]interface{}{"name": "echo.echo", "arguments": map[string]interface{}{"text": "a"}}}}, assistant["tool_calls"])
+		tool := messages[2].(map[string]interface{})
+		assert.Equal(t, "tool", tool["role"])
+		assert.Equal(t, "echo.echo", tool["tool_name"])
+
+		fmt.Fprint(w, `{"model": "test-model", "message": {"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "echo.echo", "arguments": {"text": "b"}}}]}, "done": true, "done_reason": "stop"}`)
+	})
+
+	response, err := client.CallChatCompletion(context.Background(), []Message{
+		{Role: "user", Content: "echo a then b"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "a"}`}}}},
+		{Role: "tool", Content: "a", ToolCallID: "call_1", Name: "echo.echo"},
+	}, []Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo", Parameters: json.RawMessage(`{"type": "object"}`)}}})
+	require.NoError(t, err)
+
+	choice := response.Choices[0]
+	assert.Equal(t, "tool_calls", choice.FinishReason)
+	assert.Equal(t, []ToolCall{{Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "b"}`}}}, choice.Message.ToolCalls)
+}
+
+func TestOllamaClientStream(t *testing.T) {
+	client := newTestOllamaClient(t, &OllamaClientConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, true, req["stream"])
+		assert.Nil(t, req["tools"], `tool choice "none" withholds the tools`)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, chunk := range []string{
+			`{"message": {"role": "assistant", "content": "Hello"}, "done": false}`,
+			`{"message": {"role": "assistant", "content": " there"}, "done": false}`,
+			`{"message": {"role": "assistant", "content": ""}, "done": true, "done_reason": "length"}`,
+		} {
+			fmt.Fprintln(w, chunk)
+		}
+	})
+
+	var deltas []string
+	response, err := client.StreamChatCompletionWithToolChoice(context.Background(), []Message{{Role: "user", Content: "hi"}},
+		[]Tool{{Type: "function", Function: ToolFunction{Name: "echo.echo"}}}, "none", func(delta string) { deltas = append(deltas, delta) })
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Hello", " there"}, deltas)
+	assert.Equal(t, "Hello there", response.Choices[0].Message.Content)
+	assert.Equal(t, "length", response.Choices[0].FinishReason)
+}
+
+func TestOllamaClientStreamError(t *testing.T) {
+	client := newTestOllamaClient(t, &OllamaClientConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "Hel"}, "done": false}`)
+		fmt.Fprintln(w, `{"error": "model ran out of memory"}`)
+	})
+
+	_, err := client.StreamChatCompletionWithToolChoice(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, nil, nil)
+	assert.ErrorContains(t, err, "ollama error: model ran out of memory")
+}
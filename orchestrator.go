@@ -2,12 +2,17 @@ package go_as
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
+
+	mcpcore "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
 )
 
 // Orchestrator is the main struct for the module.
@@ -15,71 +20,107 @@ type Orchestrator struct {
 	config     *OrchestratorConfig
 	logger     *slog.Logger
 	mcpClients map[string]*MCPClient // Use a map of MCPClient
-	llmClient  *LLMClient
+	mcpMu      sync.RWMutex          // Guards mcpClients and keeps toolCatalog in step with it
+	llmClient  LLMProvider
+
+	toolCatalog *ToolCatalog // Tools of every managed MCP, refreshed on tools/list_changed
+
+	strategies map[string]AgentStrategy // Strategies requests can select, by name
+	strategyMu sync.RWMutex             // Guards strategies
+
+	approvals   *ApprovalManager    // Tool calls waiting for a human decision
+	jsonRepairs *JSONRepairRecorder // Malformed JSON repaired in the LLM responses of every task
 }
 
+// MCPInfo describes a managed MCP agent as reported by ListMCPs.
+type MCPInfo struct {
+	Alias     string         `json:"alias"`
+	Transport MCPTransport   `json:"transport"`
+	State     MCPClientState `json:"state"`
+}
+
+// mcpDrainTimeout bounds how long RemoveMCP and ReplaceMCP wait for in-flight tool calls.
+const mcpDrainTimeout = 30 * time.Second
+
 // NewOrchestrator creates a new instance of the orchestrator.
 func NewOrchestrator(config *OrchestratorConfig, logger *slog.Logger) (*Orchestrator, error) {
-	llmConfig := &LLMClientConfig{
-		ServerURL: GetLLMServerURL(),
-		ModelName: GetLLMModelName(),
-		Timeout:   GetLLMTimeout(),
+	var llmClient LLMProvider
+	if config != nil && config.LLM != nil {
+		llmClient = config.LLM
+	} else {
+		var err error
+		if llmClient, err = NewLLMProviderFromEnv(logger); err != nil {
+			return nil, fmt.Errorf("failed to create LLM provider: %w", err)
+		}
+	}
+	o := &Orchestrator{
+		config:      config,
+		logger:      logger,
+		mcpClients:  make(map[string]*MCPClient), // Initialize the map
+		llmClient:   llmClient,
+		toolCatalog: NewToolCatalog(),
+		strategies:  make(map[string]AgentStrategy),
+		jsonRepairs: NewJSONRepairRecorder(),
+	}
+	approvalPolicy := ApprovalPolicy{}
+	if config != nil && config.Approvals != nil {
+		approvalPolicy = *config.Approvals
+	}
+	o.approvals = NewApprovalManager(approvalPolicy)
+	for _, strategy := range []AgentStrategy{PlanExecuteStrategy{}, ReActStrategy{}, RouterStrategy{}} {
+		o.strategies[strategy.Name()] = strategy
 	}
-	return &Orchestrator{
-		config:     config,
-		logger:     logger,
-		mcpClients: make(map[string]*MCPClient), // Initialize the map
-		llmClient:  NewLLMClient(llmConfig, logger),
-	}, nil
+	return o, nil
 }
 
-// ExecuteTask executes an orchestration task based on the request.
-func (o *Orchestrator) ExecuteTask(request *OrchestrationRequest, updateChan chan<- OrchestrationUpdate) {
+// RegisterStrategy makes strategy selectable by its name in OrchestrationRequest.Strategy,
+// replacing any strategy registered under the same name, including a built-in one.
+func (o *Orchestrator) RegisterStrategy(strategy AgentStrategy) error {
+	if strategy.Name() == "" {
+		return fmt.Errorf("strategy name cannot be empty")
+	}
+	o.strategyMu.Lock()
+	defer o.strategyMu.Unlock()
+	o.strategies[strategy.Name()] = strategy
+	return nil
+}
+
+// strategy returns the strategy registered as name, or the configured default if name is empty.
+func (o *Orchestrator) strategy(name string) (AgentStrategy, error) {
+	if name == "" {
+		name = StrategyPlanExecute
+		if o.config != nil && o.config.DefaultStrategy != "" {
+			name = o.config.DefaultStrategy
+		}
+	}
+	o.strategyMu.RLock()
+	defer o.strategyMu.RUnlock()
+	strategy, ok := o.strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown agent strategy %q", name)
+	}
+	return strategy, nil
+}
+
+// ExecuteTask executes an orchestration task based on the request. Cancelling ctx stops the task;
+// updates that can no longer be delivered because ctx is done are dropped.
+func (o *Orchestrator) ExecuteTask(ctx context.Context, request *OrchestrationRequest, updateChan chan<- OrchestrationUpdate) {
 	defer close(updateChan)
 
-	o.logger.Info("Orchestrator: Starting task execution.", "query", request.Query)
+	o.logger.Info("Orchestrator: Starting task execution.", "query", request.Query, "strategy", request.Strategy, "dry_run", request.DryRun)
 
-	// 1. Fetch available tools from connected MCP agents
-	var availableTools []Tool
-	o.logger.Info("Orchestrator: Fetching available tools from MCP agents.")
-	for alias, client := range o.mcpClients {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		// Get the tool definitions from the MCP agent
-		mcpTools, err := client.GetTools(ctx)
-		if err != nil {
-			o.logger.Error("Orchestrator: Failed to get tools from MCP agent", "alias", alias, "error", err)
-			continue
-		}
-		o.logger.Info("Orchestrator: Found tools for agent", "alias", alias, "count", len(mcpTools))
-
-		// Convert MCP tool definitions to LLM-compatible Tool format
-		for _, mcpTool := range mcpTools {
-
-			// Construct the full tool name as "agentAlias.toolName"
-			fullToolName := fmt.Sprintf("%s.%s", alias, mcpTool.Name)
-
-			// We need to convert it to a raw JSON string for the LLM Tool.Parameters field
-			paramsBytes, err := json.Marshal(mcpTool.InputSchema)
-			if err != nil {
-				o.logger.Error("Orchestrator: Failed to marshal tool input schema", "tool", fullToolName, "error", err)
-				continue
-			}
-
-			availableTools = append(availableTools, Tool{
-				Type: "function",
-				Function: ToolFunction{
-					Name:        fullToolName,
-					Description: mcpTool.Description,
-					Parameters:  json.RawMessage(paramsBytes),
-				},
-			})
-		}
+	strategy, err := o.strategy(request.Strategy)
+	if err != nil {
+		sendUpdate(ctx, updateChan, OrchestrationUpdate{Type: UpdateTypeError, Content: err.Error(), Error: err})
+		o.logger.Error("Orchestrator: Invalid strategy.", "error", err)
+		return
 	}
 
+	// 1. Snapshot the agents and their cached tools so MCPs added or removed mid-task don't race with this run
+	mcpClients, availableTools := o.snapshot()
+
 	if len(availableTools) == 0 {
-		updateChan <- OrchestrationUpdate{Type: "error", Content: "No tools available from connected agents.", Error: fmt.Errorf("no tools available")}
+		sendUpdate(ctx, updateChan, OrchestrationUpdate{Type: UpdateTypeError, Content: "No tools available from connected agents.", Error: fmt.Errorf("no tools available")})
 		o.logger.Error("Orchestrator: No tools available from connected agents.")
 		return
 	}
@@ -87,30 +128,271 @@ func (o *Orchestrator) ExecuteTask(request *OrchestrationRequest, updateChan cha
 
 	// 2. Create and execute the agent
 	o.logger.Info("Orchestrator: Creating and executing agent.")
-	agent := NewAgent(o.llmClient, o.mcpClients, o.logger, availableTools)
-	finalResult, err := agent.Execute(context.Background(), request.Query)
+	agent := NewAgent(o.llmClient, mcpClients, o.logger, availableTools)
+	agent.SetUpdateChannel(updateChan)
+	agent.SetBudget(o.budget())
+	agent.SetStrategy(strategy)
+	agent.SetApprovals(o.approvals)
+	agent.SetJSONRepairRecorder(o.jsonRepairs)
+	agent.SetDryRun(request.DryRun)
+	finalResult, err := agent.Execute(ctx, request.Query)
+	record := agent.Record()
+	var budgetErr *BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		// The partial answer is still worth showing to the user.
+		sendUpdate(ctx, updateChan, OrchestrationUpdate{Type: UpdateTypeError, Content: finalResult, Error: err, Record: &record})
+		o.logger.Warn("Orchestrator: Agent stopped by its budget.", "budget", budgetErr.Budget, "detail", budgetErr.Detail)
+		return
+	}
 	if err != nil {
-		updateChan <- OrchestrationUpdate{Type: "error", Content: fmt.Sprintf("Agent execution failed: %v", err), Error: err}
+		sendUpdate(ctx, updateChan, OrchestrationUpdate{Type: UpdateTypeError, Content: fmt.Sprintf("Agent execution failed: %v", err), Error: err, Record: &record})
 		o.logger.Error("Orchestrator: Agent execution failed.", "error", err)
 		return
 	}
 
-	updateChan <- OrchestrationUpdate{Type: "result", Content: finalResult}
+	sendUpdate(ctx, updateChan, OrchestrationUpdate{Type: UpdateTypeResult, Content: finalResult, Model: record.Model, DryRun: record.DryRun, Record: &record})
 	o.logger.Info("Orchestrator: Task completed successfully.", "result", finalResult)
 }
 
+// PendingApprovals returns the tool calls of running tasks that are waiting for a decision.
+func (o *Orchestrator) PendingApprovals() []PendingApproval {
+	return o.approvals.Pending()
+}
+
+// LLMHealth reports the health of each LLM provider when the orchestrator's provider is an
+// LLMFallback. Other providers have no circuit breakers, and the result is empty.
+func (o *Orchestrator) LLMHealth() []LLMProviderHealth {
+	if fallback, ok := o.llmClient.(*LLMFallback); ok {
+		return fallback.Health()
+	}
+	return []LLMProviderHealth{}
+}
+
+// DecideApproval approves or rejects the paused tool call identified by the ApprovalID of an
+// approval_required update. The task resumes either way; a rejected call is reported to the LLM.
+func (o *Orchestrator) DecideApproval(id string, decision ApprovalDecision) error {
+	return o.approvals.Decide(id, decision)
+}
+
+// budget returns the per-task budget from the configuration, or DefaultAgentBudget.
+func (o *Orchestrator) budget() AgentBudget {
+	if o.config != nil && o.config.Budget != nil {
+		return *o.config.Budget
+	}
+	return DefaultAgentBudget()
+}
+
+// sendUpdate delivers update unless ctx is done, so a task never blocks on a reader that went away.
+func sendUpdate(ctx context.Context, updateChan chan<- OrchestrationUpdate, update OrchestrationUpdate) {
+	if update.Error != nil && update.ErrorMessage == "" {
+		update.ErrorMessage = update.Error.Error()
+	}
+	select {
+	case updateChan <- update:
+	case <-ctx.Done():
+	}
+}
+
 // ManageMCP manages the lifecycle and configuration of an MCP.
 func (o *Orchestrator) ManageMCP(config *MCPConfig) error {
-	o.logger.Info("Orchestrator: Connecting MCP", "alias", config.Alias, "command", config.Command)
-	client, err := NewMCPClient(config.Alias, config.Command, config.Args, o.logger)
+	o.mcpMu.RLock()
+	_, exists := o.mcpClients[config.Alias]
+	o.mcpMu.RUnlock()
+	if exists {
+		return fmt.Errorf("MCP %s is already managed; use ReplaceMCP to swap it", config.Alias)
+	}
+
+	client, err := o.connectMCP(config)
 	if err != nil {
-		return fmt.Errorf("failed to create MCP client for %s: %w", config.Alias, err)
+		return err
+	}
+
+	tools, err := o.fetchTools(config.Alias, client)
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	o.mcpMu.Lock()
+	if _, exists := o.mcpClients[config.Alias]; exists {
+		o.mcpMu.Unlock()
+		client.Close()
+		return fmt.Errorf("MCP %s is already managed; use ReplaceMCP to swap it", config.Alias)
 	}
 	o.mcpClients[config.Alias] = client
+	o.setCatalogTools(config.Alias, tools)
+	o.mcpMu.Unlock()
+
 	o.logger.Info("Orchestrator: MCP connected successfully.", "alias", config.Alias)
 	return nil
 }
 
+// ReplaceMCP connects a new MCP under config.Alias and swaps it in for the existing one.
+// The old client is closed once its in-flight tool calls have finished. If the new
+// connection cannot be established the existing client is left untouched.
+func (o *Orchestrator) ReplaceMCP(config *MCPConfig) error {
+	client, err := o.connectMCP(config)
+	if err != nil {
+		return err
+	}
+
+	tools, err := o.fetchTools(config.Alias, client)
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	o.mcpMu.Lock()
+	old := o.mcpClients[config.Alias]
+	o.mcpClients[config.Alias] = client
+	o.setCatalogTools(config.Alias, tools)
+	o.mcpMu.Unlock()
+
+	o.logger.Info("Orchestrator: MCP replaced.", "alias", config.Alias)
+	if old == nil {
+		return nil
+	}
+	return o.shutdownMCP(config.Alias, old)
+}
+
+// RemoveMCP disconnects the MCP registered under alias. New tasks stop seeing it
+// immediately; the client is closed once its in-flight tool calls have finished.
+func (o *Orchestrator) RemoveMCP(alias string) error {
+	o.mcpMu.Lock()
+	client, ok := o.mcpClients[alias]
+	delete(o.mcpClients, alias)
+	o.toolCatalog.Remove(alias)
+	o.mcpMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("MCP %s is not managed", alias)
+	}
+	o.logger.Info("Orchestrator: MCP removed.", "alias", alias)
+	return o.shutdownMCP(alias, client)
+}
+
+// ListMCPs returns the managed MCP agents sorted by alias.
+func (o *Orchestrator) ListMCPs() []MCPInfo {
+	o.mcpMu.RLock()
+	infos := make([]MCPInfo, 0, len(o.mcpClients))
+	for alias, client := range o.mcpClients {
+		info := MCPInfo{Alias: alias, State: client.State()}
+		if client.config != nil {
+			info.Transport = MCPTransport(transportName(client.config.Transport))
+		}
+		infos = append(infos, info)
+	}
+	o.mcpMu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Alias < infos[j].Alias })
+	return infos
+}
+
+// MCPState reports the connection state of the MCP agent registered under alias.
+func (o *Orchestrator) MCPState(alias string) (MCPClientState, bool) {
+	o.mcpMu.RLock()
+	client, ok := o.mcpClients[alias]
+	o.mcpMu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	return client.State(), true
+}
+
+// JSONRepairStats returns, by source, how often JSON from the LLM needed repairing in the
+// tasks run by this orchestrator.
+func (o *Orchestrator) JSONRepairStats() map[string]JSONRepairMetrics {
+	return o.jsonRepairs.Stats()
+}
+
+// connectMCP creates and initializes a client for config without registering it.
+func (o *Orchestrator) connectMCP(config *MCPConfig) (*MCPClient, error) {
+	o.logger.Info("Orchestrator: Connecting MCP", "alias", config.Alias, "transport", transportName(config.Transport), "command", config.Command, "url", config.URL)
+	client, err := NewMCPClientWithConfig(config, o.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP client for %s: %w", config.Alias, err)
+	}
+	client.OnToolsChanged(func() { o.refreshTools(config.Alias, client) })
+	return client, nil
+}
+
+// fetchTools lists the tools of client. An agent whose tools cannot be listed right after
+// connecting is not managed, since nothing guarantees a later refresh would fill its catalog.
+func (o *Orchestrator) fetchTools(alias string, client *MCPClient) ([]mcpcore.Tool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mcpTools, err := client.GetTools(ctx)
+	if err != nil {
+		o.logger.Error("Orchestrator: Failed to get tools from MCP agent", "alias", alias, "error", err)
+		return nil, fmt.Errorf("failed to get tools from MCP %s: %w", alias, err)
+	}
+	o.logger.Info("Orchestrator: Found tools for agent", "alias", alias, "count", len(mcpTools))
+	return mcpTools, nil
+}
+
+// refreshTools re-fetches the tools of client and updates the catalog, unless the
+// client has been removed or replaced in the meantime. On failure the previous tools are kept.
+func (o *Orchestrator) refreshTools(alias string, client *MCPClient) {
+	tools, err := o.fetchTools(alias, client)
+	if err != nil {
+		return
+	}
+
+	o.mcpMu.Lock()
+	defer o.mcpMu.Unlock()
+	if o.mcpClients[alias] != client {
+		return
+	}
+	o.setCatalogTools(alias, tools)
+}
+
+// setCatalogTools stores tools in the catalog. Callers must hold mcpMu.
+func (o *Orchestrator) setCatalogTools(alias string, tools []mcpcore.Tool) {
+	if err := o.toolCatalog.Set(alias, tools); err != nil {
+		o.logger.Error("Orchestrator: Failed to catalog some tools", "alias", alias, "error", err)
+	}
+}
+
+// shutdownMCP drains and closes a client that is no longer registered.
+func (o *Orchestrator) shutdownMCP(alias string, client *MCPClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mcpDrainTimeout)
+	defer cancel()
+	if err := client.Shutdown(ctx); err != nil {
+		o.logger.Warn("Orchestrator: MCP closed before in-flight calls finished.", "alias", alias, "error", err)
+		return err
+	}
+	return nil
+}
+
+// snapshot returns a copy of the managed clients together with the matching catalog
+// tools, safe to use without holding mcpMu.
+func (o *Orchestrator) snapshot() (map[string]*MCPClient, []Tool) {
+	o.mcpMu.RLock()
+	defer o.mcpMu.RUnlock()
+	clients := make(map[string]*MCPClient, len(o.mcpClients))
+	for alias, client := range o.mcpClients {
+		clients[alias] = client
+	}
+	return clients, o.toolCatalog.Tools()
+}
+
+// RegisterInProcessMCP exposes an mcp-go server living in this process under the given alias.
+func (o *Orchestrator) RegisterInProcessMCP(alias string, server *mcpserver.MCPServer) error {
+	return o.ManageMCP(&MCPConfig{
+		Alias:     alias,
+		Transport: MCPTransportInProcess,
+		Server:    server,
+	})
+}
+
+// RegisterMCPTools wraps a set of Go tool handlers in an in-process MCP server and registers it under the given alias.
+func (o *Orchestrator) RegisterMCPTools(alias string, tools ...mcpserver.ServerTool) error {
+	server := mcpserver.NewMCPServer(alias, "1.0.0", mcpserver.WithToolCapabilities(true))
+	server.AddTools(tools...)
+	return o.RegisterInProcessMCP(alias, server)
+}
+
 // GetLLMServerURL retrieves the LLM server URL from environment variable or returns default.
 func GetLLMServerURL() string {
 	serverURL := os.Getenv("LLM_SERVER_URL")
@@ -0,0 +1,396 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StructuredPlan is a plan given as JSON instead of a numbered list. Its steps form a DAG:
+// a step runs once the steps it depends on have finished, so independent steps run
+// concurrently and no LLM round-trip is needed between steps.
+type StructuredPlan struct {
+	Steps []PlanStep `json:"steps"`
+}
+
+// PlanStep is one step of a StructuredPlan.
+type PlanStep struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	// Tool is the full "alias.tool" name to call. A step without a tool only describes work
+	// left for the final answer.
+	Tool string `json:"tool,omitempty"`
+	// Arguments for Tool. String values may reference the output of earlier steps with
+	// {{steps.<id>.output}}, or a field of a JSON output with {{steps.<id>.output.<field>...}}.
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	// DependsOn lists the steps that must finish first. Steps referenced in Arguments are added automatically.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// stepOutputPattern matches an argument template referencing a step output, capturing the step ID and field path.
+var stepOutputPattern = regexp.MustCompile(`\{\{\s*steps\.([A-Za-z0-9_-]+)\.output((?:\.[A-Za-z0-9_-]+)*)\s*\}\}`)
+
+// parseStructuredPlan parses planContent as a StructuredPlan. It returns nil without an error
+// if the content is not JSON, i.e. the plan is a numbered list.
+func parseStructuredPlan(planContent string) (*StructuredPlan, error) {
+	if !strings.HasPrefix(strings.TrimSpace(planContent), "{") {
+		return nil, nil
+	}
+	var plan StructuredPlan
+	if err := json.Unmarshal([]byte(planContent), &plan); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal structured plan: %w", err)
+	}
+	if err := plan.validate(); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// validate checks step IDs and dependencies, adds the dependencies implied by argument
+// templates and rejects cycles.
+func (p *StructuredPlan) validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("structured plan has no steps")
+	}
+	index := make(map[string]int, len(p.Steps))
+	for i, step := range p.Steps {
+		if step.ID == "" {
+			return fmt.Errorf("structured plan step %d has no id", i+1)
+		}
+		if _, dup := index[step.ID]; dup {
+			return fmt.Errorf("structured plan has duplicate step id %q", step.ID)
+		}
+		index[step.ID] = i
+	}
+
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		for _, match := range stepOutputPattern.FindAllStringSubmatch(string(step.Arguments), -1) {
+			if !containsString(step.DependsOn, match[1]) {
+				step.DependsOn = append(step.DependsOn, match[1])
+			}
+		}
+		for _, dep := range step.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return fmt.Errorf("structured plan step %q depends on unknown step %q", step.ID, dep)
+			}
+		}
+	}
+
+	// Kahn's algorithm: every step must become ready once its dependencies are done.
+	pending := make(map[string]int, len(p.Steps))
+	dependents := make(map[string][]string)
+	var ready []string
+	for _, step := range p.Steps {
+		pending[step.ID] = len(step.DependsOn)
+		for _, dep := range step.DependsOn {
+			dependents[dep] = append(dependents[dep], step.ID)
+		}
+		if len(step.DependsOn) == 0 {
+			ready = append(ready, step.ID)
+		}
+	}
+	visited := 0
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		visited++
+		for _, dependent := range dependents[id] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if visited != len(p.Steps) {
+		return fmt.Errorf("structured plan has a dependency cycle")
+	}
+	return nil
+}
+
+// descriptions returns the step descriptions, used as the plan's steps in updates and prompts.
+func (p *StructuredPlan) descriptions() []string {
+	steps := make([]string, len(p.Steps))
+	for i, step := range p.Steps {
+		steps[i] = fmt.Sprintf("[%s] %s", step.ID, step.Description)
+	}
+	return steps
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// runStructuredPlan executes the tool steps of plan, each as soon as its dependencies have
+// succeeded, substituting earlier outputs into its arguments. Steps whose dependencies
+// failed are skipped with a step_skipped update. As in runToolCalls, steps calling the
+// same MCP agent never overlap, since they may depend on each other's side effects; they
+// run one at a time in the order they become ready. A step waiting for approval does not
+// hold up the others. The executed calls and their results
+// are added to the history for Nexus to write the final answer from.
+func (a *Agent) runStructuredPlan(ctx context.Context, plan *StructuredPlan) error {
+	if a.dryRun {
+		return a.planStructuredDryRun(ctx, plan)
+	}
+	var mu sync.Mutex // Guards outputs, failed, fatal and the tool call budget
+	outputs := make(map[string]string, len(plan.Steps))
+	failed := make(map[string]bool)
+	var fatal error
+
+	done := make(map[string]chan struct{}, len(plan.Steps))
+	aliasLocks := make(map[string]*sync.Mutex)
+	for _, step := range plan.Steps {
+		done[step.ID] = make(chan struct{})
+		alias, _, _ := strings.Cut(step.Tool, ".")
+		if _, ok := aliasLocks[alias]; !ok {
+			aliasLocks[alias] = &sync.Mutex{}
+		}
+	}
+	toolCalls := make([]*ToolCall, len(plan.Steps))
+	outcomes := make([]toolCallOutcome, len(plan.Steps))
+
+	var wg sync.WaitGroup
+	for i, step := range plan.Steps {
+		wg.Add(1)
+		go func(i int, step PlanStep) {
+			defer wg.Done()
+			defer close(done[step.ID])
+			for _, dep := range step.DependsOn {
+				<-done[dep]
+			}
+
+			mu.Lock()
+			var skipReason string
+			if fatal != nil || ctx.Err() != nil {
+				skipReason = "the plan was aborted"
+			} else {
+				for _, dep := range step.DependsOn {
+					if failed[dep] {
+						skipReason = fmt.Sprintf("step %q did not succeed", dep)
+						break
+					}
+				}
+			}
+			if skipReason != "" {
+				failed[step.ID] = true
+			}
+			mu.Unlock()
+			if skipReason != "" {
+				a.logger.Info("Agent: Skipping plan step.", "step", step.ID, "reason", skipReason)
+				a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeStepSkipped, Step: i + 1, Content: fmt.Sprintf("Skipped %q: %s.", step.ID, skipReason)})
+				return
+			}
+
+			a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeStepStarted, Step: i + 1, Content: step.Description})
+			if step.Tool == "" {
+				mu.Lock()
+				outputs[step.ID] = ""
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			arguments, resolveErr := resolveStepArguments(step.Arguments, outputs)
+			toolCall := &ToolCall{ID: "step_" + step.ID, Type: "function", Function: FunctionCall{Name: step.Tool, Arguments: arguments}}
+			if resolveErr != nil {
+				toolCall.Function.Arguments = string(step.Arguments)
+			} else if err := a.checkToolCallBudget([]ToolCall{*toolCall}); err != nil {
+				fatal = err
+				failed[step.ID] = true
+				mu.Unlock()
+				return
+			}
+			toolCalls[i] = toolCall
+			mu.Unlock()
+
+			var outcome toolCallOutcome
+			var err error
+			if resolveErr != nil {
+				content := fmt.Sprintf("Tool execution failed: %v", resolveErr)
+				a.logger.Error("Agent: Failed to resolve step arguments.", "step", step.ID, "error", resolveErr)
+				a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeToolCall, Step: i + 1, Tool: step.Tool, Arguments: toolCall.Function.Arguments})
+				a.emit(ctx, OrchestrationUpdate{Type: UpdateTypeToolResult, Step: i + 1, Tool: step.Tool, Content: content, Error: resolveErr})
+				outcome = toolCallOutcome{content: content, failure: resolveErr}
+			} else {
+				alias, _, _ := strings.Cut(step.Tool, ".")
+				outcome, err = a.runToolCall(ctx, i+1, toolCall, aliasLocks[alias])
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			outcomes[i] = outcome
+			switch {
+			case err != nil:
+				fatal = err
+				failed[step.ID] = true
+			case outcome.failure != nil:
+				failed[step.ID] = true
+			default:
+				outputs[step.ID] = outcome.content
+			}
+		}(i, step)
+	}
+	wg.Wait()
+	if fatal != nil {
+		return fatal
+	}
+
+	// Record the executed steps as one assistant turn so the history stays a valid tool-calling transcript.
+	assistant := Message{Role: "assistant"}
+	var results []Message
+	for i, toolCall := range toolCalls {
+		if toolCall == nil {
+			continue
+		}
+		assistant.ToolCalls = append(assistant.ToolCalls, *toolCall)
+		results = append(results, Message{Role: "tool", Content: outcomes[i].content, ToolCallID: toolCall.ID, Name: toolCall.Function.Name, toolFailed: outcomes[i].failure != nil})
+	}
+	if len(results) > 0 {
+		a.history = append(a.history, assistant)
+		a.history = append(a.history, results...)
+	}
+	a.currentStepIdx = len(plan.Steps)
+	return nil
+}
+
+// planStructuredDryRun records every tool step of plan for a dry run. Step output
+// templates are left in the arguments, since the outputs they refer to do not exist.
+func (a *Agent) planStructuredDryRun(ctx context.Context, plan *StructuredPlan) error {
+	var toolCalls []ToolCall
+	var steps []int
+	for i, step := range plan.Steps {
+		if step.Tool == "" {
+			continue
+		}
+		arguments := string(step.Arguments)
+		if arguments == "" {
+			arguments = "{}"
+		}
+		toolCalls = append(toolCalls, ToolCall{ID: "step_" + step.ID, Type: "function", Function: FunctionCall{Name: step.Tool, Arguments: arguments}})
+		steps = append(steps, i+1)
+	}
+	a.recordDryRun(ctx, toolCalls, steps, true)
+	return errDryRunStopped
+}
+
+// resolveStepArguments substitutes step output templates in arguments and returns the
+// resulting JSON. A string that is exactly one template is replaced by the referenced
+// value itself, keeping its JSON type; templates inside longer strings are replaced by text.
+func resolveStepArguments(arguments json.RawMessage, outputs map[string]string) (string, error) {
+	if len(arguments) == 0 {
+		return "{}", nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(arguments, &value); err != nil {
+		return "", fmt.Errorf("failed to unmarshal step arguments: %w", err)
+	}
+	resolved, err := resolveTemplates(value, outputs)
+	if err != nil {
+		return "", err
+	}
+	resolvedJSON, err := json.Marshal(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal step arguments: %w", err)
+	}
+	return string(resolvedJSON), nil
+}
+
+func resolveTemplates(value interface{}, outputs map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return resolveTemplateString(v, outputs)
+	case map[string]interface{}:
+		for key, elem := range v {
+			resolved, err := resolveTemplates(elem, outputs)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = resolved
+		}
+		return v, nil
+	case []interface{}:
+		for i, elem := range v {
+			resolved, err := resolveTemplates(elem, outputs)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+func resolveTemplateString(s string, outputs map[string]string) (interface{}, error) {
+	matches := stepOutputPattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) {
+		return stepOutputValue(outputs, s[matches[0][2]:matches[0][3]], s[matches[0][4]:matches[0][5]])
+	}
+
+	var builder strings.Builder
+	last := 0
+	for _, match := range matches {
+		value, err := stepOutputValue(outputs, s[match[2]:match[3]], s[match[4]:match[5]])
+		if err != nil {
+			return nil, err
+		}
+		builder.WriteString(s[last:match[0]])
+		if text, ok := value.(string); ok {
+			builder.WriteString(text)
+		} else {
+			encoded, _ := json.Marshal(value)
+			builder.Write(encoded)
+		}
+		last = match[1]
+	}
+	builder.WriteString(s[last:])
+	return builder.String(), nil
+}
+
+// stepOutputValue returns the output of step id, or the field at path (".a.0.b") of its JSON output.
+func stepOutputValue(outputs map[string]string, id string, path string) (interface{}, error) {
+	output, ok := outputs[id]
+	if !ok {
+		return nil, fmt.Errorf("step %q has no output", id)
+	}
+	if path == "" {
+		return output, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		return nil, fmt.Errorf("output of step %q is not JSON, cannot select %s", id, path)
+	}
+	for _, field := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			elem, ok := v[field]
+			if !ok {
+				return nil, fmt.Errorf("output of step %q has no field %s", id, path)
+			}
+			value = elem
+		case []interface{}:
+			i, err := strconv.Atoi(field)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("output of step %q has no element %s", id, path)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("output of step %q has no field %s", id, path)
+		}
+	}
+	return value, nil
+}
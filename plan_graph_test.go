@@ -0,0 +1,314 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mcpcore "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+func TestParseStructuredPlan(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantNil     bool
+		wantErr     string
+		wantDepends map[string][]string
+	}{
+		{name: "numbered list", content: "1. Do it.\n2. Answer.", wantNil: true},
+		{
+			name:        "templates imply dependencies",
+			content:     `{"steps": [{"id": "a", "tool": "x.a"}, {"id": "b", "tool": "x.b", "arguments": {"in": "{{steps.a.output}}"}}, {"id": "c", "depends_on": ["b"]}]}`,
+			wantDepends: map[string][]string{"a": nil, "b": {"a"}, "c": {"b"}},
+		},
+		{name: "invalid JSON", content: `{"steps": [`, wantErr: "failed to unmarshal structured plan"},
+		{name: "no steps", content: `{"steps": []}`, wantErr: "no steps"},
+		{name: "missing id", content: `{"steps": [{"tool": "x.a"}]}`, wantErr: "has no id"},
+		{name: "duplicate id", content: `{"steps": [{"id": "a"}, {"id": "a"}]}`, wantErr: "duplicate step id"},
+		{name: "unknown dependency", content: `{"steps": [{"id": "a", "depends_on": ["b"]}]}`, wantErr: `unknown step "b"`},
+		{name: "unknown template step", content: `{"steps": [{"id": "a", "arguments": {"in": "{{steps.z.output}}"}}]}`, wantErr: `unknown step "z"`},
+		{name: "cycle", content: `{"steps": [{"id": "a", "depends_on": ["b"]}, {"id": "b", "depends_on": ["a"]}]}`, wantErr: "dependency cycle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := parseStructuredPlan(tt.content)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, plan)
+				return
+			}
+			for _, step := range plan.Steps {
+				assert.Equal(t, tt.wantDepends[step.ID], step.DependsOn, step.ID)
+			}
+		})
+	}
+}
+
+func TestResolveStepArguments(t *testing.T) {
+	outputs := map[string]string{
+		"text": "hello",
+		"list": `{"items": [{"path": "a.txt", "size": 3}]}`,
+	}
+	tests := []struct {
+		name      string
+		arguments string
+		want      string
+		wantErr   string
+	}{
+		{name: "no arguments", arguments: "", want: `{}`},
+		{name: "no templates", arguments: `{"path": "."}`, want: `{"path":"."}`},
+		{name: "whole output", arguments: `{"text": "{{steps.text.output}}"}`, want: `{"text":"hello"}`},
+		{name: "typed field", arguments: `{"size": "{{ steps.list.output.items.0.size }}"}`, want: `{"size":3}`},
+		{name: "embedded in text", arguments: `{"msg": "got {{steps.text.output}} from {{steps.list.output.items.0.path}}"}`, want: `{"msg":"got hello from a.txt"}`},
+		{name: "nested values", arguments: `{"paths": ["{{steps.list.output.items.0.path}}"]}`, want: `{"paths":["a.txt"]}`},
+		{name: "missing output", arguments: `{"text": "{{steps.other.output}}"}`, wantErr: `step "other" has no output`},
+		{name: "field of text output", arguments: `{"text": "{{steps.text.output.field}}"}`, wantErr: "is not JSON"},
+		{name: "missing field", arguments: `{"path": "{{steps.list.output.items.1.path}}"}`, wantErr: "has no element"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveStepArguments(json.RawMessage(tt.arguments), outputs)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, got)
+		})
+	}
+}
+
+func TestAgentRunsStructuredPlan(t *testing.T) {
+	plan := `{"steps": [
+		{"id": "left", "description": "Get the left value.", "tool": "a.left"},
+		{"id": "right", "description": "Get the right value.", "tool": "b.right"},
+		{"id": "join", "description": "Join both values.", "tool": "a.join", "arguments": {"left": "{{steps.left.output}}", "right": "{{steps.right.output.value}}"}},
+		{"id": "answer", "description": "Answer.", "depends_on": ["join"]}
+	]}`
+
+	var llmCalls atomic.Int32
+	var finalHistory []Message
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		llmCalls.Add(1)
+
+		message := Message{Role: "assistant", Content: "Final answer"}
+		if strings.Contains(req.Messages[0].Content, "Nexus Orchestrator") {
+			message = Message{Role: "assistant", Content: "<plan>\n" + plan + "\n</plan>"}
+		} else {
+			finalHistory = req.Messages
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+	}))
+	defer mockLLMServer.Close()
+
+	// left and right each wait for the other, so the test fails unless independent steps run concurrently.
+	leftStarted, rightStarted := make(chan struct{}), make(chan struct{})
+	rendezvous := func(mine, other chan struct{}, result string) mcpserver.ToolHandlerFunc {
+		return func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+			close(mine)
+			select {
+			case <-other:
+				return mcpcore.NewToolResultText(result), nil
+			case <-time.After(2 * time.Second):
+				return mcpcore.NewToolResultError("steps did not run concurrently"), nil
+			}
+		}
+	}
+	var joinArgs map[string]interface{}
+	serverA := mcpserver.NewMCPServer("a", "1.0.0")
+	serverA.AddTool(mcpcore.NewTool("left"), rendezvous(leftStarted, rightStarted, "L"))
+	serverA.AddTool(mcpcore.NewTool("join"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		joinArgs = request.GetArguments()
+		return mcpcore.NewToolResultText("L+R"), nil
+	})
+	serverB := mcpserver.NewMCPServer("b", "1.0.0")
+	serverB.AddTool(mcpcore.NewTool("right"), rendezvous(rightStarted, leftStarted, `{"value": "R"}`))
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+	mcpClients := map[string]*MCPClient{}
+	for alias, server := range map[string]*mcpserver.MCPServer{"a": serverA, "b": serverB} {
+		client, err := NewMCPClientWithConfig(&MCPConfig{Alias: alias, Transport: MCPTransportInProcess, Server: server}, logger)
+		require.NoError(t, err)
+		defer client.Close()
+		mcpClients[alias] = client
+	}
+
+	agent := NewAgent(llmClient, mcpClients, logger, nil)
+	finalResult, err := agent.Execute(context.Background(), "join the values")
+	require.NoError(t, err)
+	assert.Equal(t, "Final answer", finalResult)
+
+	// One planning call and one call for the final answer; no round-trip per step.
+	assert.Equal(t, int32(2), llmCalls.Load())
+	assert.Equal(t, map[string]interface{}{"left": "L", "right": "R"}, joinArgs)
+
+	assertValidToolTranscript(t, finalHistory)
+	var results []string
+	for _, message := range finalHistory {
+		if message.Role == "tool" {
+			results = append(results, message.ToolCallID+"="+message.Content)
+		}
+	}
+	assert.Equal(t, []string{"step_left=L", `step_right={"value": "R"}`, "step_join=L+R"}, results)
+	assert.Contains(t, finalHistory[0].Content, "All steps of the plan have been executed")
+}
+
+func TestAgentStructuredPlanSerializesAliasAndReportsSkips(t *testing.T) {
+	plan := `{"steps": [
+		{"id": "first", "description": "Write the first value.", "tool": "a.write"},
+		{"id": "second", "description": "Write the second value.", "tool": "a.write"},
+		{"id": "broken", "description": "Call a failing tool.", "tool": "a.fail"},
+		{"id": "after", "description": "Use the failed output.", "tool": "a.write", "arguments": {"value": "{{steps.broken.output}}"}}
+	]}`
+
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		message := Message{Role: "assistant", Content: "Final answer"}
+		if strings.Contains(req.Messages[0].Content, "Nexus Orchestrator") {
+			message = Message{Role: "assistant", Content: "<plan>\n" + plan + "\n</plan>"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+	}))
+	defer mockLLMServer.Close()
+
+	var running, overlaps, writes atomic.Int32
+	server := mcpserver.NewMCPServer("a", "1.0.0")
+	server.AddTool(mcpcore.NewTool("write"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		writes.Add(1)
+		return mcpcore.NewToolResultText("ok"), nil
+	})
+	server.AddTool(mcpcore.NewTool("fail"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		return mcpcore.NewToolResultError("boom"), nil
+	})
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+	client, err := NewMCPClientWithConfig(&MCPConfig{Alias: "a", Transport: MCPTransportInProcess, Server: server}, logger)
+	require.NoError(t, err)
+	defer client.Close()
+
+	updates := make(chan OrchestrationUpdate, 100)
+	agent := NewAgent(llmClient, map[string]*MCPClient{"a": client}, logger, nil)
+	agent.SetUpdateChannel(updates)
+	_, err = agent.Execute(context.Background(), "write the values")
+	require.NoError(t, err)
+	close(updates)
+
+	assert.Equal(t, int32(2), writes.Load())
+	assert.Zero(t, overlaps.Load(), "steps calling the same MCP agent overlapped")
+
+	var skipped []OrchestrationUpdate
+	for update := range updates {
+		if update.Type == UpdateTypeStepSkipped {
+			skipped = append(skipped, update)
+		}
+	}
+	require.Len(t, skipped, 1)
+	assert.Equal(t, 4, skipped[0].Step)
+	assert.Equal(t, `Skipped "after": step "broken" did not succeed.`, skipped[0].Content)
+}
+
+func TestAgentStructuredPlanApprovalAndUnresolvedArguments(t *testing.T) {
+	plan := `{"steps": [
+		{"id": "gated", "description": "Call a tool that needs approval.", "tool": "a.gated"},
+		{"id": "first", "description": "Write a value.", "tool": "a.write"},
+		{"id": "unresolved", "description": "Use a missing field.", "tool": "a.write", "arguments": {"value": "{{steps.first.output.missing}}"}}
+	]}`
+
+	mockLLMServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		message := Message{Role: "assistant", Content: "Final answer"}
+		if strings.Contains(req.Messages[0].Content, "Nexus Orchestrator") {
+			message = Message{Role: "assistant", Content: "<plan>\n" + plan + "\n</plan>"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+	}))
+	defer mockLLMServer.Close()
+
+	var writes atomic.Int32
+	server := mcpserver.NewMCPServer("a", "1.0.0")
+	server.AddTool(mcpcore.NewTool("write"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		writes.Add(1)
+		return mcpcore.NewToolResultText("ok"), nil
+	})
+	server.AddTool(mcpcore.NewTool("gated"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		return mcpcore.NewToolResultText("done"), nil
+	})
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	llmClient := NewLLMClient(&LLMClientConfig{ServerURL: mockLLMServer.URL, ModelName: "test-model", Timeout: 5 * time.Second}, logger)
+	client, err := NewMCPClientWithConfig(&MCPConfig{Alias: "a", Transport: MCPTransportInProcess, Server: server}, logger)
+	require.NoError(t, err)
+	defer client.Close()
+
+	approvals := NewApprovalManager(ApprovalPolicy{Tools: []string{"a.gated"}})
+	updates := make(chan OrchestrationUpdate, 100)
+	agent := NewAgent(llmClient, map[string]*MCPClient{"a": client}, logger, nil)
+	agent.SetUpdateChannel(updates)
+	agent.SetApprovals(approvals)
+
+	// Approve the gated step only once the other step on the same agent has run.
+	var received []OrchestrationUpdate
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for update := range updates {
+			received = append(received, update)
+			if update.Type == UpdateTypeApprovalRequired {
+				assert.Eventually(t, func() bool { return writes.Load() == 1 }, 2*time.Second, 10*time.Millisecond,
+					"a step waiting for approval held up another step on its agent")
+				assert.NoError(t, approvals.Decide(update.ApprovalID, ApprovalDecision{Approved: true}))
+			}
+		}
+	}()
+	_, err = agent.Execute(context.Background(), "write the values")
+	require.NoError(t, err)
+	close(updates)
+	<-readerDone
+
+	var unresolved []OrchestrationUpdate
+	for _, update := range received {
+		if update.Step == 3 && (update.Type == UpdateTypeToolCall || update.Type == UpdateTypeToolResult) {
+			unresolved = append(unresolved, update)
+		}
+	}
+	require.Len(t, unresolved, 2)
+	assert.Equal(t, UpdateTypeToolCall, unresolved[0].Type)
+	assert.Equal(t, "a.write", unresolved[0].Tool)
+	assert.Equal(t, UpdateTypeToolResult, unresolved[1].Type)
+	assert.Error(t, unresolved[1].Error)
+	assert.Contains(t, unresolved[1].Content, "Tool execution failed")
+}
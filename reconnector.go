@@ -7,11 +7,11 @@ import (
 
 // Reconnector is responsible for reconnecting the final results to the main LLM instance.
 type Reconnector struct {
-	llmClient *LLMClient
+	llmClient LLMProvider
 }
 
 // NewReconnector creates a new instance of the Reconnector.
-func NewReconnector(llmClient *LLMClient) *Reconnector {
+func NewReconnector(llmClient LLMProvider) *Reconnector {
 	return &Reconnector{
 		llmClient: llmClient,
 	}
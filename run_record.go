@@ -0,0 +1,29 @@
+package go_as
+
+import "time"
+
+// RunRecord keeps what happened during an agent run.
+type RunRecord struct {
+	Query    string        `json:"query"`
+	Strategy string        `json:"strategy"`          // Name of the AgentStrategy that ran the task
+	Plans    []PlanVersion `json:"plans"`             // Every plan the run used, oldest first
+	DryRun   *DryRunReport `json:"dry_run,omitempty"` // What a dry run would have done; nil for normal runs
+	Model    string        `json:"model,omitempty"`   // Model that produced the run's latest LLM response
+}
+
+// PlanVersion is one version of a run's plan. Version 1 is the initial plan; later
+// versions replace it when the agent replans.
+type PlanVersion struct {
+	Version   int       `json:"version"`
+	Steps     []string  `json:"steps"`
+	Reason    string    `json:"reason,omitempty"` // Why the previous plan was replaced; empty for the initial plan
+	Model     string    `json:"model,omitempty"`  // Model that wrote the plan
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// addPlan records a new plan version, written by model, and returns its number.
+func (r *RunRecord) addPlan(steps []string, reason, model string) int {
+	version := len(r.Plans) + 1
+	r.Plans = append(r.Plans, PlanVersion{Version: version, Steps: steps, Reason: reason, Model: model, CreatedAt: time.Now()})
+	return version
+}
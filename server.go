@@ -2,8 +2,11 @@ package go_as
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 )
 
 // Server is the HTTP server for the go-as module.
@@ -23,11 +26,20 @@ func NewServer(orchestrator *Orchestrator, logger *slog.Logger) *Server {
 // Start starts the HTTP server.
 func (s *Server) Start(addr string) error {
 	http.HandleFunc("/orchestrate", s.handleOrchestrate)
+	http.HandleFunc("/orchestrate/stream", s.handleOrchestrateStream)
+	http.HandleFunc("/approvals", s.handleApprovals)
+	http.HandleFunc("/approvals/", s.handleApprovalDecision)
+	http.HandleFunc("/llm/health", s.handleLLMHealth)
 	s.logger.Info("Server listening on", "addr", addr)
 	return http.ListenAndServe(addr, nil)
 }
 
 func (s *Server) handleOrchestrate(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.handleOrchestrateStream(w, r)
+		return
+	}
+
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
@@ -40,10 +52,10 @@ func (s *Server) handleOrchestrate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	updateChan := make(chan OrchestrationUpdate)
-	go s.orchestrator.ExecuteTask(&req, updateChan)
+	go s.orchestrator.ExecuteTask(r.Context(), &req, updateChan)
 
 	for update := range updateChan {
-		if update.Type == "result" || update.Type == "error" {
+		if update.Type == UpdateTypeResult || update.Type == UpdateTypeError {
 			w.Header().Set("Content-Type", "application/json")
 			if err := json.NewEncoder(w).Encode(update); err != nil {
 				s.logger.Error("Failed to write response", "error", err)
@@ -52,3 +64,117 @@ func (s *Server) handleOrchestrate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// handleOrchestrateStream runs a task and forwards every OrchestrationUpdate to the client
+// as a Server-Sent Event named after the update type. The stream ends after the final
+// result or error; if the client disconnects first, the task is cancelled.
+func (s *Server) handleOrchestrateStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var req OrchestrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// The server only notices a client disconnect (and cancels r.Context()) once the body has been read to EOF.
+	io.Copy(io.Discard, r.Body)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The request context is cancelled when the client goes away, which stops the task.
+	ctx := r.Context()
+	updateChan := make(chan OrchestrationUpdate)
+	go s.orchestrator.ExecuteTask(ctx, &req, updateChan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Client disconnected, cancelling orchestration stream", "error", ctx.Err())
+			return
+		case update, ok := <-updateChan:
+			if !ok {
+				return
+			}
+			if err := writeSSEUpdate(w, update); err != nil {
+				s.logger.Error("Failed to write stream event", "error", err)
+				return
+			}
+			flusher.Flush()
+			if update.Type == UpdateTypeResult || update.Type == UpdateTypeError {
+				return
+			}
+		}
+	}
+}
+
+// writeSSEUpdate writes a single update as an SSE event.
+func writeSSEUpdate(w http.ResponseWriter, update OrchestrationUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to marshal update: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", update.Type, data)
+	return err
+}
+
+// handleApprovals lists the tool calls waiting for a decision.
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.orchestrator.PendingApprovals()); err != nil {
+		s.logger.Error("Failed to write response", "error", err)
+	}
+}
+
+// handleLLMHealth reports the circuit state of each LLM provider.
+func (s *Server) handleLLMHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.orchestrator.LLMHealth()); err != nil {
+		s.logger.Error("Failed to write response", "error", err)
+	}
+}
+
+// handleApprovalDecision approves or rejects the tool call in POST /approvals/{id}, with an
+// ApprovalDecision as the body.
+func (s *Server) handleApprovalDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/approvals/")
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "Invalid approval id", http.StatusNotFound)
+		return
+	}
+
+	var decision ApprovalDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := s.orchestrator.DecideApproval(id, decision); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
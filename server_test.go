@@ -0,0 +1,204 @@
+package go_as
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOrchestrator returns an orchestrator pointed at llmHandler with an in-process echo agent.
+func newTestOrchestrator(t *testing.T, llmHandler http.HandlerFunc) *Orchestrator {
+	mockLLMServer := httptest.NewServer(llmHandler)
+	t.Cleanup(mockLLMServer.Close)
+	t.Setenv("LLM_SERVER_URL", mockLLMServer.URL)
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	orchestrator, err := NewOrchestrator(&OrchestratorConfig{}, logger)
+	require.NoError(t, err)
+	require.NoError(t, orchestrator.RegisterInProcessMCP("echo", newEchoMCPServer()))
+	return orchestrator
+}
+
+func TestHandleOrchestrateStream(t *testing.T) {
+	orchestrator := newTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{
+			Message:      Message{Role: "assistant", Content: "<plan>\n1. Provide a direct answer.\n</plan>\n{\"tool_calls\": []}\nHello!"},
+			FinishReason: "stop",
+		}}})
+	})
+	server := NewServer(orchestrator, orchestrator.logger)
+	httpServer := httptest.NewServer(http.HandlerFunc(server.handleOrchestrate))
+	defer httpServer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, httpServer.URL, strings.NewReader(`{"query": "hi"}`))
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var events []string
+	var last OrchestrationUpdate
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+		if strings.HasPrefix(line, "data: ") {
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &last))
+		}
+	}
+
+	require.NotEmpty(t, events)
+	assert.Contains(t, events, UpdateTypePlan)
+	assert.Equal(t, UpdateTypeResult, events[len(events)-1])
+	assert.Contains(t, last.Content, "Hello!")
+	require.NotNil(t, last.Record)
+	require.Len(t, last.Record.Plans, 1)
+	assert.Equal(t, []string{"Provide a direct answer."}, last.Record.Plans[0].Steps)
+}
+
+func TestHandleOrchestrateStreamReportsErrorMessage(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "")
+	orchestrator := newTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusBadRequest)
+	})
+	server := NewServer(orchestrator, orchestrator.logger)
+	httpServer := httptest.NewServer(http.HandlerFunc(server.handleOrchestrateStream))
+	defer httpServer.Close()
+
+	resp, err := http.Post(httpServer.URL, "application/json", strings.NewReader(`{"query": "hi"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var event string
+	var data map[string]interface{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			event = strings.TrimPrefix(line, "event: ")
+		}
+		if strings.HasPrefix(line, "data: ") {
+			data = nil
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data))
+		}
+	}
+
+	assert.Equal(t, UpdateTypeError, event)
+	assert.Contains(t, data["error_message"], "model not loaded")
+	assert.NotContains(t, data, "error")
+}
+
+func TestHandleOrchestrateStreamCancelsOnDisconnect(t *testing.T) {
+	llmStarted := make(chan struct{})
+	llmCancelled := make(chan struct{})
+	orchestrator := newTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body) // Lets the server notice the disconnect
+		close(llmStarted)
+		<-r.Context().Done()
+		close(llmCancelled)
+	})
+	server := NewServer(orchestrator, orchestrator.logger)
+	httpServer := httptest.NewServer(http.HandlerFunc(server.handleOrchestrateStream))
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, httpServer.URL, strings.NewReader(`{"query": "hi"}`))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Disconnect only once the task is waiting on the LLM.
+	select {
+	case <-llmStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("LLM request was never made")
+	}
+	cancel()
+	select {
+	case <-llmCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("LLM request was not cancelled after the client disconnected")
+	}
+}
+
+func TestApprovalEndpoints(t *testing.T) {
+	orchestrator := newTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		message := Message{Role: "assistant", Content: "Final answer"}
+		if strings.Contains(req.Messages[0].Content, "Nexus Orchestrator") {
+			message = Message{Role: "assistant", Content: "<plan>\n1. Echo.\n</plan>", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "hi"}`}}}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{Choices: []ChatCompletionChoice{{Message: message, FinishReason: "stop"}}})
+	})
+	orchestrator.approvals = NewApprovalManager(ApprovalPolicy{Tools: []string{"echo.*"}})
+
+	server := NewServer(orchestrator, orchestrator.logger)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orchestrate/stream", server.handleOrchestrateStream)
+	mux.HandleFunc("/approvals", server.handleApprovals)
+	mux.HandleFunc("/approvals/", server.handleApprovalDecision)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	resp, err := http.Post(httpServer.URL+"/orchestrate/stream", "application/json", strings.NewReader(`{"query": "echo hi"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var events []string
+	var last OrchestrationUpdate
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &last))
+		if last.Type != UpdateTypeApprovalRequired {
+			continue
+		}
+
+		listResp, err := http.Get(httpServer.URL + "/approvals")
+		require.NoError(t, err)
+		var pending []PendingApproval
+		require.NoError(t, json.NewDecoder(listResp.Body).Decode(&pending))
+		listResp.Body.Close()
+		require.Len(t, pending, 1)
+		assert.Equal(t, last.ApprovalID, pending[0].ID)
+		assert.Equal(t, "echo.echo", pending[0].Tool)
+
+		decide := func() int {
+			decisionResp, err := http.Post(httpServer.URL+"/approvals/"+last.ApprovalID, "application/json", strings.NewReader(`{"approved": true}`))
+			require.NoError(t, err)
+			decisionResp.Body.Close()
+			return decisionResp.StatusCode
+		}
+		assert.Equal(t, http.StatusNoContent, decide())
+		assert.Equal(t, http.StatusNotFound, decide())
+	}
+
+	assert.Contains(t, events, UpdateTypeApprovalRequired)
+	assert.Equal(t, UpdateTypeResult, last.Type)
+	assert.Equal(t, "Final answer", last.Content)
+}
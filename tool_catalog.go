@@ -0,0 +1,113 @@
+package go_as
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	mcpcore "github.com/mark3labs/mcp-go/mcp"
+)
+
+// ToolCatalog caches the tools exposed by every managed MCP agent so that tasks
+// don't have to query each agent on every request.
+type ToolCatalog struct {
+	mu      sync.RWMutex
+	byAlias map[string][]catalogEntry
+}
+
+// catalogEntry pairs an MCP tool definition with its LLM-facing form.
+type catalogEntry struct {
+	mcpTool mcpcore.Tool
+	llmTool Tool
+}
+
+// NewToolCatalog creates an empty ToolCatalog.
+func NewToolCatalog() *ToolCatalog {
+	return &ToolCatalog{byAlias: make(map[string][]catalogEntry)}
+}
+
+// Set replaces the cached tools for alias. Tools whose input schema cannot be
+// marshalled are skipped and reported in the returned error.
+func (c *ToolCatalog) Set(alias string, mcpTools []mcpcore.Tool) error {
+	entries := make([]catalogEntry, 0, len(mcpTools))
+	var skipped []string
+	for _, mcpTool := range mcpTools {
+		// Construct the full tool name as "agentAlias.toolName"
+		fullToolName := fmt.Sprintf("%s.%s", alias, mcpTool.Name)
+
+		// We need to convert it to a raw JSON string for the LLM Tool.Parameters field
+		paramsBytes, err := json.Marshal(mcpTool.InputSchema)
+		if err != nil {
+			skipped = append(skipped, fullToolName)
+			continue
+		}
+
+		entries = append(entries, catalogEntry{
+			mcpTool: mcpTool,
+			llmTool: Tool{
+				Type: "function",
+				Function: ToolFunction{
+					Name:        fullToolName,
+					Description: mcpTool.Description,
+					Parameters:  json.RawMessage(paramsBytes),
+				},
+			},
+		})
+	}
+
+	c.mu.Lock()
+	c.byAlias[alias] = entries
+	c.mu.Unlock()
+
+	if len(skipped) > 0 {
+		return fmt.Errorf("failed to marshal input schema for tools %v", skipped)
+	}
+	return nil
+}
+
+// Remove drops every cached tool for alias.
+func (c *ToolCatalog) Remove(alias string) {
+	c.mu.Lock()
+	delete(c.byAlias, alias)
+	c.mu.Unlock()
+}
+
+// Tools returns the LLM-facing definitions of all cached tools, ordered by alias
+// and then by the order the agent reported them.
+func (c *ToolCatalog) Tools() []Tool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	aliases := make([]string, 0, len(c.byAlias))
+	for alias := range c.byAlias {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	var tools []Tool
+	for _, alias := range aliases {
+		for _, entry := range c.byAlias[alias] {
+			tools = append(tools, entry.llmTool)
+		}
+	}
+	return tools
+}
+
+// Lookup returns the MCP definition of the tool with the given full "alias.tool" name.
+func (c *ToolCatalog) Lookup(fullToolName string) (mcpcore.Tool, bool) {
+	parts := strings.SplitN(fullToolName, ".", 2)
+	if len(parts) != 2 {
+		return mcpcore.Tool{}, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, entry := range c.byAlias[parts[0]] {
+		if entry.mcpTool.Name == parts[1] {
+			return entry.mcpTool, true
+		}
+	}
+	return mcpcore.Tool{}, false
+}
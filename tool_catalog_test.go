@@ -0,0 +1,68 @@
+package go_as
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mcpcore "github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+func toolNames(tools []Tool) []string {
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Function.Name)
+	}
+	return names
+}
+
+func TestToolCatalogRefreshesOnListChanged(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	orchestrator, err := NewOrchestrator(&OrchestratorConfig{}, logger)
+	require.NoError(t, err)
+
+	echoServer := newEchoMCPServer()
+	sseServer := mcpserver.NewTestServer(echoServer)
+	defer sseServer.Close()
+
+	require.NoError(t, orchestrator.ManageMCP(&MCPConfig{Alias: "remote", Transport: MCPTransportSSE, URL: sseServer.URL + "/sse"}))
+	require.NoError(t, orchestrator.RegisterInProcessMCP("local", newEchoMCPServer()))
+	defer orchestrator.RemoveMCP("remote")
+
+	assert.Equal(t, []string{"local.echo", "remote.echo"}, toolNames(orchestrator.toolCatalog.Tools()))
+
+	// Adding a tool makes the server emit notifications/tools/list_changed.
+	echoServer.AddTool(mcpcore.NewTool("shout"), func(ctx context.Context, request mcpcore.CallToolRequest) (*mcpcore.CallToolResult, error) {
+		return mcpcore.NewToolResultText("HELLO"), nil
+	})
+	require.Eventually(t, func() bool {
+		_, ok := orchestrator.toolCatalog.Lookup("remote.shout")
+		return ok
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, []string{"local.echo", "remote.echo", "remote.shout"}, toolNames(orchestrator.toolCatalog.Tools()))
+
+	tool, ok := orchestrator.toolCatalog.Lookup("local.echo")
+	require.True(t, ok)
+	assert.Equal(t, []string{"text"}, tool.InputSchema.Required)
+
+	require.NoError(t, orchestrator.RemoveMCP("local"))
+	assert.Equal(t, []string{"remote.echo", "remote.shout"}, toolNames(orchestrator.toolCatalog.Tools()))
+}
+
+func TestManageMCPFailsWhenToolsCannotBeListed(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	orchestrator, err := NewOrchestrator(&OrchestratorConfig{}, logger)
+	require.NoError(t, err)
+
+	// A server without the tools capability answers tools/list with an error.
+	err = orchestrator.RegisterInProcessMCP("toolless", mcpserver.NewMCPServer("toolless", "1.0.0"))
+	assert.ErrorContains(t, err, "failed to get tools from MCP toolless")
+	assert.Empty(t, orchestrator.ListMCPs())
+	assert.Empty(t, orchestrator.toolCatalog.Tools())
+}
@@ -0,0 +1,322 @@
+package go_as
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validateToolArguments checks the JSON arguments of a tool call against the tool's input
+// schema and returns one message per problem found, or nil if the arguments are valid.
+// With allowTemplates, strings that are entirely a step output template ({{steps.<id>.output}})
+// are accepted wherever they appear, since their value is only known when the plan runs.
+func validateToolArguments(schema json.RawMessage, arguments string, allowTemplates bool) []string {
+	var value interface{}
+	if strings.TrimSpace(arguments) == "" {
+		value = map[string]interface{}{}
+	} else if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return []string{fmt.Sprintf("arguments are not valid JSON: %v", err)}
+	}
+	if len(schema) == 0 || string(schema) == "null" {
+		return nil
+	}
+	var schemaMap map[string]interface{}
+	if err := json.Unmarshal(schema, &schemaMap); err != nil {
+		return nil // A schema we cannot read is left for the MCP server to enforce
+	}
+	v := &schemaValidator{allowTemplates: allowTemplates}
+	v.validate(schemaMap, value, "$")
+	return v.errs
+}
+
+// schemaValidator implements the subset of JSON Schema used by MCP tool input schemas:
+// type, properties, required, additionalProperties, items, enum, const, anyOf, oneOf, allOf,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern,
+// minItems and maxItems. Other keywords, including $ref, are ignored.
+type schemaValidator struct {
+	allowTemplates bool
+	errs           []string
+}
+
+func (v *schemaValidator) errorf(path string, format string, args ...interface{}) {
+	v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if s, ok := value.(string); ok && v.allowTemplates {
+		if loc := stepOutputPattern.FindStringIndex(s); loc != nil && loc[0] == 0 && loc[1] == len(s) {
+			return
+		}
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !matchesAnyType(value, types) {
+		v.errorf(path, "expected %s, got %s", strings.Join(types, " or "), jsonTypeName(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, value) {
+		encoded, _ := json.Marshal(enum)
+		v.errorf(path, "must be one of %s", encoded)
+	}
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		encoded, _ := json.Marshal(constant)
+		v.errorf(path, "must be %s", encoded)
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		if options, ok := schema[keyword].([]interface{}); ok && !v.matchesAny(options, value, path) {
+			v.errorf(path, "does not match any of the allowed schemas")
+		}
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				v.validate(subSchema, value, path)
+			}
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, value, path)
+	case []interface{}:
+		v.validateArray(schema, value, path)
+	case string:
+		v.validateString(schema, value, path)
+	case float64:
+		v.validateNumber(schema, value, path)
+	}
+}
+
+func (v *schemaValidator) validateObject(schema map[string]interface{}, value map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := value[name]; !present {
+					v.errorf(path, "missing required property %q", name)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Report problems in a stable order
+	for _, name := range names {
+		propertyPath := path + "." + name
+		if propertySchema, ok := properties[name].(map[string]interface{}); ok {
+			v.validate(propertySchema, value[name], propertyPath)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.errorf(propertyPath, "unexpected property")
+			}
+		case map[string]interface{}:
+			v.validate(additional, value[name], propertyPath)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(schema map[string]interface{}, value []interface{}, path string) {
+	if min, ok := schema["minItems"].(float64); ok && float64(len(value)) < min {
+		v.errorf(path, "must have at least %v items", min)
+	}
+	if max, ok := schema["maxItems"].(float64); ok && float64(len(value)) > max {
+		v.errorf(path, "must have at most %v items", max)
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range value {
+			v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(schema map[string]interface{}, value string, path string) {
+	length := float64(len([]rune(value)))
+	if min, ok := schema["minLength"].(float64); ok && length < min {
+		v.errorf(path, "must be at least %v characters long", min)
+	}
+	if max, ok := schema["maxLength"].(float64); ok && length > max {
+		v.errorf(path, "must be at most %v characters long", max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			v.errorf(path, "must match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(schema map[string]interface{}, value float64, path string) {
+	if min, ok := schema["minimum"].(float64); ok && value < min {
+		v.errorf(path, "must be at least %v", min)
+	}
+	if max, ok := schema["maximum"].(float64); ok && value > max {
+		v.errorf(path, "must be at most %v", max)
+	}
+	if min, ok := schema["exclusiveMinimum"].(float64); ok && value <= min {
+		v.errorf(path, "must be greater than %v", min)
+	}
+	if max, ok := schema["exclusiveMaximum"].(float64); ok && value >= max {
+		v.errorf(path, "must be less than %v", max)
+	}
+}
+
+// matchesAny reports whether value is valid against at least one of the schemas in options.
+func (v *schemaValidator) matchesAny(options []interface{}, value interface{}, path string) bool {
+	for _, option := range options {
+		optionSchema, ok := option.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		sub := &schemaValidator{allowTemplates: v.allowTemplates}
+		sub.validate(optionSchema, value, path)
+		if len(sub.errs) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypes returns the types allowed by a "type" keyword, which may be a string or a list.
+func schemaTypes(typ interface{}) []string {
+	switch typ := typ.(type) {
+	case string:
+		return []string{typ}
+	case []interface{}:
+		var types []string
+		for _, t := range typ {
+			if t, ok := t.(string); ok {
+				types = append(types, t)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesAnyType(value interface{}, types []string) bool {
+	for _, typ := range types {
+		switch typ {
+		case "integer":
+			if n, ok := value.(float64); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "number":
+			if _, ok := value.(float64); ok {
+				return true
+			}
+		default:
+			if jsonTypeName(value) == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonTypeName returns the JSON Schema type name of a decoded JSON value.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if jsonEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonEqual(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+// ToolArgumentsError reports tool call arguments that do not match the tool's input schema.
+// The call is not sent to the MCP server; the problems are returned to the LLM instead.
+type ToolArgumentsError struct {
+	Tool     string
+	Problems []string
+}
+
+func (e *ToolArgumentsError) Error() string {
+	return fmt.Sprintf("invalid arguments for %s: %s", e.Tool, strings.Join(e.Problems, "; "))
+}
+
+// toolResult returns the error as the JSON content of the tool message, so the LLM can see
+// exactly which arguments to correct.
+func (e *ToolArgumentsError) toolResult() string {
+	content, _ := json.Marshal(struct {
+		Error    string   `json:"error"`
+		Tool     string   `json:"tool"`
+		Problems []string `json:"problems"`
+		Hint     string   `json:"hint"`
+	}{
+		Error:    "invalid_arguments",
+		Tool:     e.Tool,
+		Problems: e.Problems,
+		Hint:     "The tool was not called. Correct the arguments to match the tool's input schema and call it again.",
+	})
+	return string(content)
+}
+
+// toolSchema returns the input schema of the named tool, as cached in the tool catalog when
+// the task started, and whether the tool is one of the agent's available tools.
+func (a *Agent) toolSchema(name string) (json.RawMessage, bool) {
+	for _, tool := range a.availableTools {
+		if tool.Function.Name != name {
+			continue
+		}
+		schema, err := json.Marshal(tool.Function.Parameters)
+		if err != nil {
+			return nil, true
+		}
+		return schema, true
+	}
+	return nil, false
+}
+
+// checkToolArguments returns a *ToolArgumentsError if toolCall's arguments do not match its
+// tool's input schema. Tools the agent has no schema for are left to the MCP server to check.
+func (a *Agent) checkToolArguments(toolCall *ToolCall) error {
+	schema, ok := a.toolSchema(toolCall.Function.Name)
+	if !ok {
+		return nil
+	}
+	if problems := validateToolArguments(schema, toolCall.Function.Arguments, false); len(problems) > 0 {
+		return &ToolArgumentsError{Tool: toolCall.Function.Name, Problems: problems}
+	}
+	return nil
+}
+
+// validateToolCall validates toolCall's arguments against the input schema of the tool it
+// names, which must be one of the agent's available tools.
+func (a *Agent) validateToolCall(toolCall *ToolCall, allowTemplates bool) []string {
+	schema, ok := a.toolSchema(toolCall.Function.Name)
+	if !ok {
+		return []string{fmt.Sprintf("unknown tool %q", toolCall.Function.Name)}
+	}
+	return validateToolArguments(schema, toolCall.Function.Arguments, allowTemplates)
+}
@@ -0,0 +1,103 @@
+package go_as
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateToolArguments(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"path": {"type": "string", "minLength": 1},
+			"mode": {"type": "string", "enum": ["read", "write"]},
+			"depth": {"type": "integer", "minimum": 0, "maximum": 5},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"options": {"type": "object", "properties": {"force": {"type": "boolean"}}, "additionalProperties": false}
+		},
+		"required": ["path"],
+		"additionalProperties": false
+	}`)
+
+	tests := []struct {
+		name           string
+		schema         json.RawMessage
+		arguments      string
+		allowTemplates bool
+		want           []string
+	}{
+		{name: "valid", schema: schema, arguments: `{"path": "a.txt", "mode": "read", "depth": 2, "tags": ["x"], "options": {"force": true}}`},
+		{name: "no schema", arguments: `{"anything": 1}`},
+		{name: "empty arguments", schema: json.RawMessage(`{"type": "object"}`), arguments: ""},
+		{name: "not JSON", schema: schema, arguments: `{"path": `, want: []string{"arguments are not valid JSON: unexpected end of JSON input"}},
+		{name: "missing required", schema: schema, arguments: `{}`, want: []string{`$: missing required property "path"`}},
+		{name: "wrong type", schema: schema, arguments: `{"path": 3}`, want: []string{"$.path: expected string, got number"}},
+		{name: "not an integer", schema: schema, arguments: `{"path": "a", "depth": 1.5}`, want: []string{"$.depth: expected integer, got number"}},
+		{name: "out of range", schema: schema, arguments: `{"path": "a", "depth": 9}`, want: []string{"$.depth: must be at most 5"}},
+		{name: "not in enum", schema: schema, arguments: `{"path": "a", "mode": "delete"}`, want: []string{`$.mode: must be one of ["read","write"]`}},
+		{name: "too short", schema: schema, arguments: `{"path": ""}`, want: []string{"$.path: must be at least 1 characters long"}},
+		{
+			name:      "array items",
+			schema:    schema,
+			arguments: `{"path": "a", "tags": ["x", 2, "z"]}`,
+			want:      []string{"$.tags: must have at most 2 items", "$.tags[1]: expected string, got number"},
+		},
+		{
+			name:      "unexpected properties",
+			schema:    schema,
+			arguments: `{"path": "a", "recursive": true, "options": {"force": "yes", "dry": true}}`,
+			want:      []string{"$.options.dry: unexpected property", "$.options.force: expected boolean, got string", "$.recursive: unexpected property"},
+		},
+		{name: "arguments not an object", schema: schema, arguments: `["a"]`, want: []string{"$: expected object, got array"}},
+		{name: "template rejected", schema: schema, arguments: `{"path": "a", "depth": "{{steps.list.output.depth}}"}`, want: []string{"$.depth: expected integer, got string"}},
+		{name: "template allowed", schema: schema, arguments: `{"path": "a", "depth": "{{steps.list.output.depth}}"}`, allowTemplates: true},
+		{
+			name:      "anyOf",
+			schema:    json.RawMessage(`{"type": "object", "properties": {"id": {"anyOf": [{"type": "string"}, {"type": "integer"}]}}}`),
+			arguments: `{"id": true}`,
+			want:      []string{"$.id: does not match any of the allowed schemas"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateToolArguments(tt.schema, tt.arguments, tt.allowTemplates))
+		})
+	}
+}
+
+func TestAgentRejectsInvalidToolArguments(t *testing.T) {
+	var requests [][]Message
+	agent := newStrategyTestAgent(t, []Message{
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"txt": "hi"}`}}}},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_2", Type: "function", Function: FunctionCall{Name: "echo.echo", Arguments: `{"text": "hi"}`}}}},
+		{Role: "assistant", Content: "Final answer"},
+	}, &requests)
+	agent.availableTools[0].Function.Parameters = json.RawMessage(`{"type": "object", "properties": {"text": {"type": "string"}}, "required": ["text"]}`)
+	agent.SetStrategy(ReActStrategy{})
+
+	finalResult, err := agent.Execute(context.Background(), "echo hi")
+	require.NoError(t, err)
+	assert.Equal(t, "Final answer", finalResult)
+
+	require.Len(t, requests, 3)
+	rejected := requests[1][len(requests[1])-1]
+	assert.Equal(t, "call_1", rejected.ToolCallID)
+	var validationErr struct {
+		Error    string   `json:"error"`
+		Tool     string   `json:"tool"`
+		Problems []string `json:"problems"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(rejected.Content), &validationErr), rejected.Content)
+	assert.Equal(t, "invalid_arguments", validationErr.Error)
+	assert.Equal(t, "echo.echo", validationErr.Tool)
+	assert.Equal(t, []string{`$: missing required property "text"`}, validationErr.Problems)
+
+	corrected := requests[2][len(requests[2])-1]
+	assert.Equal(t, "call_2", corrected.ToolCallID)
+	assert.Equal(t, "hi", corrected.Content)
+}